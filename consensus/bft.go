@@ -0,0 +1,305 @@
+package consensus
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"time"
+)
+
+var (
+	ErrInvalidVote     = errors.New("invalid vote")
+	ErrConflictingVote = errors.New("conflicting vote")
+	ErrInvalidCommit   = errors.New("invalid commit certificate")
+)
+
+// BFT is a Tendermint style engine. A block is agreed on in rounds: the
+// proposer of the round proposes a block, the validators prevote for it and,
+// once more than two thirds prevoted the same block, precommit it. More than
+// two thirds of precommits for a block commit it, the precommits form the
+// commit certificate of the block. A committed block is final.
+//
+// Every validator has the same voting power.
+type BFT struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func NewBFT(interval, timeout time.Duration) *BFT {
+	return &BFT{
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Quorum returns the number of votes needed for more than two thirds of a
+// validator set of the given size.
+func Quorum(size int) int {
+	return size*2/3 + 1
+}
+
+// Authorized returns true if the public key belongs to the validator set
+func (b *BFT) Authorized(chain ChainReader, parent *proto.Header, pubKey []byte) bool {
+	return IsValidator(chain.Validators(parent), pubKey)
+}
+
+// Interval returns the time between a commit and the next height
+func (b *BFT) Interval() time.Duration {
+	return b.interval
+}
+
+// Timeout returns how long a step of the given round waits for messages.
+// Later rounds wait longer, so the validators eventually catch up with each
+// other.
+func (b *BFT) Timeout(round int) time.Duration {
+	return b.timeout + time.Duration(round)*b.timeout/2
+}
+
+// Prepare stamps the header with the given time. The round a validator
+// proposes in is decided by the BFT protocol, not by the engine.
+func (b *BFT) Prepare(chain ChainReader, parent, header *proto.Header, pubKey []byte, now time.Time) error {
+	if !b.Authorized(chain, parent, pubKey) {
+		return fmt.Errorf("%w: %x is not a validator", ErrNotProposer, pubKey)
+	}
+
+	header.Height = parent.Height + 1
+	header.Timestamp = now.UnixNano()
+	if header.Timestamp <= parent.Timestamp {
+		header.Timestamp = parent.Timestamp + 1
+	}
+	return nil
+}
+
+// Finalize sets the merkle root and the evidence hash of the block
+func (b *BFT) Finalize(chain ChainReader, block *proto.Block) {
+	finalize(block)
+}
+
+// Seal signs the block
+func (b *BFT) Seal(chain ChainReader, block *proto.Block, key *crypto.PrivateKey, stop <-chan struct{}) error {
+	types.SignBlock(key, block)
+	return nil
+}
+
+// VerifyHeader checks that the header follows its parent in time and is not
+// ahead of now by more than a timeout.
+func (b *BFT) VerifyHeader(chain ChainReader, parent, header *proto.Header, now time.Time) error {
+	if header.Timestamp <= parent.Timestamp {
+		return fmt.Errorf("%w: block is not newer than its parent", ErrOutsideSlot)
+	}
+	if header.Timestamp > now.Add(b.timeout).UnixNano() {
+		return fmt.Errorf("%w: %w", ErrOutsideSlot, ErrFutureBlock)
+	}
+	return nil
+}
+
+// VerifySeal checks that the block was signed by a validator
+func (b *BFT) VerifySeal(chain ChainReader, parent *proto.Header, block *proto.Block) error {
+	if err := verifySignature(block); err != nil {
+		return err
+	}
+	if !b.Authorized(chain, parent, block.PublicKey) {
+		return fmt.Errorf("%w: block signed by %x", ErrWrongProposer, block.PublicKey)
+	}
+	return nil
+}
+
+// VerifyCommit checks that the certificate holds precommits for the header
+// from more than two thirds of the validators of the header.
+func (b *BFT) VerifyCommit(chain ChainReader, header *proto.Header, cert *proto.CommitCertificate) error {
+	parent := chain.GetHeader(header.PrevHash)
+	if parent == nil {
+		return fmt.Errorf("%w: parent %x is unknown", ErrInvalidCommit, header.PrevHash)
+	}
+	if cert.Height != header.Height {
+		return fmt.Errorf("%w: certificate is for height %d", ErrInvalidCommit, cert.Height)
+	}
+	if !bytes.Equal(cert.BlockHash, types.HashHeader(header)) {
+		return fmt.Errorf("%w: certificate is for block %x", ErrInvalidCommit, cert.BlockHash)
+	}
+
+	validators := chain.Validators(parent)
+	votes := NewVoteSet(validators, int(cert.Height), int(cert.Round), proto.SignedMsgType_PRECOMMIT)
+	for i, vote := range cert.Precommits {
+		if _, err := votes.Add(vote); err != nil {
+			return fmt.Errorf("%w: precommit %d: %w", ErrInvalidCommit, i, err)
+		}
+	}
+	if hash, ok := votes.Majority(); !ok || !bytes.Equal(hash, cert.BlockHash) {
+		return fmt.Errorf("%w: %d of %d validators precommitted", ErrInvalidCommit, votes.Count(cert.BlockHash), len(validators))
+	}
+	return nil
+}
+
+// VerifyVote checks that the vote is signed by a validator of the set
+func VerifyVote(validators [][]byte, vote *proto.Vote) error {
+	if !IsValidator(validators, vote.PublicKey) {
+		return fmt.Errorf("%w: %x is not a validator", ErrInvalidVote, vote.PublicKey)
+	}
+	if !verifySigned(vote.PublicKey, vote.Signature, voteSignBytes(vote)) {
+		return fmt.Errorf("%w: signature is invalid", ErrInvalidVote)
+	}
+	return nil
+}
+
+// VerifyProposal checks that the proposal is signed by the validator of the
+// set proposing in its round and carries a block of that validator.
+func VerifyProposal(validators [][]byte, proposal *proto.Proposal) error {
+	if proposal.Block == nil || proposal.Block.Header == nil || proposal.Height != proposal.Block.Header.Height {
+		return fmt.Errorf("%w: proposal does not carry a block of its height", ErrInvalidVote)
+	}
+	proposer := Proposer(validators, int(proposal.Height), int(proposal.Round))
+	if !bytes.Equal(proposal.PublicKey, proposer) || !bytes.Equal(proposal.Block.PublicKey, proposer) {
+		return fmt.Errorf("%w: round %d of height %d belongs to %x", ErrWrongProposer, proposal.Round, proposal.Height, proposer)
+	}
+	if !verifySigned(proposal.PublicKey, proposal.Signature, proposalSignBytes(proposal)) {
+		return fmt.Errorf("%w: proposal signature is invalid", ErrInvalidVote)
+	}
+	return nil
+}
+
+// SignVote signs the vote with the key
+func SignVote(key *crypto.PrivateKey, vote *proto.Vote) {
+	vote.PublicKey = key.PublicKey().Bytes()
+	vote.Signature = key.Sign(voteSignBytes(vote)).Bytes()
+}
+
+// SignProposal signs the proposal with the key
+func SignProposal(key *crypto.PrivateKey, proposal *proto.Proposal) {
+	proposal.PublicKey = key.PublicKey().Bytes()
+	proposal.Signature = key.Sign(proposalSignBytes(proposal)).Bytes()
+}
+
+// voteSignBytes returns the hash a vote is signed over, the vote without its
+// signature.
+func voteSignBytes(vote *proto.Vote) []byte {
+	unsigned := &proto.Vote{
+		Type:      vote.Type,
+		Height:    vote.Height,
+		Round:     vote.Round,
+		BlockHash: vote.BlockHash,
+		PublicKey: vote.PublicKey,
+	}
+	hash := sha256.Sum256(types.EncodeVote(unsigned))
+	return hash[:]
+}
+
+// proposalSignBytes returns the hash a proposal is signed over. A proposal
+// is signed like a vote of type PROPOSAL for its block.
+func proposalSignBytes(proposal *proto.Proposal) []byte {
+	return voteSignBytes(&proto.Vote{
+		Type:      proto.SignedMsgType_PROPOSAL,
+		Height:    proposal.Height,
+		Round:     proposal.Round,
+		BlockHash: types.HashBlock(proposal.Block),
+		PublicKey: proposal.PublicKey,
+	})
+}
+
+func verifySigned(pubKey, signature, msg []byte) bool {
+	if len(pubKey) != crypto.PubKeyLen || len(signature) != crypto.SignatureLen {
+		return false
+	}
+	return crypto.SignatureFromBytes(signature).Verify(msg, crypto.PublicKeyFromBytes(pubKey))
+}
+
+// VoteSet collects the votes of one type of a round and tallies them by the
+// block they vote for.
+type VoteSet struct {
+	validators [][]byte
+	height     int
+	round      int
+	typ        proto.SignedMsgType
+
+	votes  map[string]*proto.Vote // by public key
+	counts map[string]int         // by block hash, "" for nil
+}
+
+func NewVoteSet(validators [][]byte, height, round int, typ proto.SignedMsgType) *VoteSet {
+	return &VoteSet{
+		validators: validators,
+		height:     height,
+		round:      round,
+		typ:        typ,
+		votes:      make(map[string]*proto.Vote),
+		counts:     make(map[string]int),
+	}
+}
+
+// Add verifies the vote and adds it to the set. It returns false if the set
+// holds the vote already. A second vote of a validator for another block
+// returns ErrConflictingVote.
+func (s *VoteSet) Add(vote *proto.Vote) (bool, error) {
+	if vote.Type != s.typ || int(vote.Height) != s.height || int(vote.Round) != s.round {
+		return false, fmt.Errorf("%w: %s for round %d of height %d does not belong to the set", ErrInvalidVote, vote.Type, vote.Round, vote.Height)
+	}
+	if err := VerifyVote(s.validators, vote); err != nil {
+		return false, err
+	}
+
+	validator := hex.EncodeToString(vote.PublicKey)
+	if prev, ok := s.votes[validator]; ok {
+		if bytes.Equal(prev.BlockHash, vote.BlockHash) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: %x voted for %x and %x", ErrConflictingVote, vote.PublicKey, prev.BlockHash, vote.BlockHash)
+	}
+
+	s.votes[validator] = vote
+	s.counts[hex.EncodeToString(vote.BlockHash)]++
+	return true, nil
+}
+
+// Size returns the number of validators that voted
+func (s *VoteSet) Size() int {
+	return len(s.votes)
+}
+
+// Count returns the number of votes for the block, nil counts the votes for nil
+func (s *VoteSet) Count(blockHash []byte) int {
+	return s.counts[hex.EncodeToString(blockHash)]
+}
+
+// HasQuorum returns true if more than two thirds of the validators voted, no
+// matter for what.
+func (s *VoteSet) HasQuorum() bool {
+	return len(s.votes) >= Quorum(len(s.validators))
+}
+
+// Majority returns the block more than two thirds of the validators voted
+// for. The hash is empty if the majority voted for nil.
+func (s *VoteSet) Majority() ([]byte, bool) {
+	for hash, count := range s.counts {
+		if count >= Quorum(len(s.validators)) {
+			b, _ := hex.DecodeString(hash)
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Certificate returns the commit certificate made of the precommits for the
+// block, or nil if there are not enough of them.
+func (s *VoteSet) Certificate(blockHash []byte) *proto.CommitCertificate {
+	if s.typ != proto.SignedMsgType_PRECOMMIT || len(blockHash) == 0 || s.Count(blockHash) < Quorum(len(s.validators)) {
+		return nil
+	}
+
+	cert := &proto.CommitCertificate{
+		Height:    int32(s.height),
+		Round:     int32(s.round),
+		BlockHash: blockHash,
+	}
+	for _, validator := range s.validators {
+		vote, ok := s.votes[hex.EncodeToString(validator)]
+		if ok && bytes.Equal(vote.BlockHash, blockHash) {
+			cert.Precommits = append(cert.Precommits, vote)
+		}
+	}
+	return cert
+}
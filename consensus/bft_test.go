@@ -0,0 +1,140 @@
+package consensus
+
+import (
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestValidators(count int) ([][]byte, []*crypto.PrivateKey) {
+	var (
+		keys       = make([]*crypto.PrivateKey, count)
+		validators = make([][]byte, count)
+	)
+	for i := range keys {
+		keys[i] = crypto.GeneratePrivateKey()
+		validators[i] = keys[i].PublicKey().Bytes()
+	}
+	return validators, keys
+}
+
+func signedVote(key *crypto.PrivateKey, typ proto.SignedMsgType, round int, hash []byte) *proto.Vote {
+	vote := &proto.Vote{Type: typ, Height: 1, Round: int32(round), BlockHash: hash}
+	SignVote(key, vote)
+	return vote
+}
+
+func TestVoteSet(t *testing.T) {
+	var (
+		validators, keys = newTestValidators(4)
+		votes            = NewVoteSet(validators, 1, 0, proto.SignedMsgType_PREVOTE)
+		hash             = util.RandomHash()
+	)
+	assert.Equal(t, 3, Quorum(4))
+	assert.Equal(t, 1, Quorum(1))
+
+	added, err := votes.Add(signedVote(keys[0], proto.SignedMsgType_PREVOTE, 0, hash))
+	require.Nil(t, err)
+	assert.True(t, added)
+	added, err = votes.Add(signedVote(keys[0], proto.SignedMsgType_PREVOTE, 0, hash))
+	require.Nil(t, err)
+	assert.False(t, added)
+
+	_, err = votes.Add(signedVote(keys[0], proto.SignedMsgType_PREVOTE, 0, nil))
+	assert.ErrorIs(t, err, ErrConflictingVote)
+	_, err = votes.Add(signedVote(keys[1], proto.SignedMsgType_PRECOMMIT, 0, hash))
+	assert.ErrorIs(t, err, ErrInvalidVote)
+	_, err = votes.Add(signedVote(keys[1], proto.SignedMsgType_PREVOTE, 1, hash))
+	assert.ErrorIs(t, err, ErrInvalidVote)
+	_, err = votes.Add(signedVote(crypto.GeneratePrivateKey(), proto.SignedMsgType_PREVOTE, 0, hash))
+	assert.ErrorIs(t, err, ErrInvalidVote)
+
+	forged := signedVote(keys[1], proto.SignedMsgType_PREVOTE, 0, nil)
+	forged.BlockHash = hash
+	_, err = votes.Add(forged)
+	assert.ErrorIs(t, err, ErrInvalidVote)
+
+	_, err = votes.Add(signedVote(keys[1], proto.SignedMsgType_PREVOTE, 0, nil))
+	require.Nil(t, err)
+	_, ok := votes.Majority()
+	assert.False(t, ok)
+	assert.False(t, votes.HasQuorum())
+
+	_, err = votes.Add(signedVote(keys[2], proto.SignedMsgType_PREVOTE, 0, hash))
+	require.Nil(t, err)
+	assert.True(t, votes.HasQuorum())
+	_, ok = votes.Majority()
+	assert.False(t, ok)
+
+	_, err = votes.Add(signedVote(keys[3], proto.SignedMsgType_PREVOTE, 0, hash))
+	require.Nil(t, err)
+	majority, ok := votes.Majority()
+	assert.True(t, ok)
+	assert.Equal(t, hash, majority)
+	assert.Nil(t, votes.Certificate(hash))
+}
+
+func TestVerifyCommit(t *testing.T) {
+	var (
+		validators, keys = newTestValidators(4)
+		chain, parent    = buildHeaders(1, time.Second, 1)
+		bft              = NewBFT(5*time.Second, 10*time.Second)
+		header           = &proto.Header{Version: 1, Height: 1, PrevHash: types.HashHeader(parent)}
+		hash             = types.HashHeader(header)
+		precommit        = NewVoteSet(validators, 1, 2, proto.SignedMsgType_PRECOMMIT)
+	)
+	chain.validators = validators
+	for _, key := range keys[:3] {
+		_, err := precommit.Add(signedVote(key, proto.SignedMsgType_PRECOMMIT, 2, hash))
+		require.Nil(t, err)
+	}
+	_, err := precommit.Add(signedVote(keys[3], proto.SignedMsgType_PRECOMMIT, 2, nil))
+	require.Nil(t, err)
+
+	cert := precommit.Certificate(hash)
+	require.NotNil(t, cert)
+	assert.Len(t, cert.Precommits, 3)
+	assert.Nil(t, bft.VerifyCommit(chain, header, cert))
+
+	// a certificate commits exactly one header
+	other := &proto.Header{Version: 1, Height: 1, PrevHash: types.HashHeader(parent), Timestamp: 1}
+	assert.ErrorIs(t, bft.VerifyCommit(chain, other, cert), ErrInvalidCommit)
+
+	// the precommits have to come from the validators of the header
+	chain.validators, _ = newTestValidators(4)
+	assert.ErrorIs(t, bft.VerifyCommit(chain, header, cert), ErrInvalidCommit)
+	chain.validators = validators
+
+	// duplicated precommits do not count twice
+	cert.Precommits[2] = cert.Precommits[1]
+	assert.ErrorIs(t, bft.VerifyCommit(chain, header, cert), ErrInvalidCommit)
+}
+
+func TestVerifyProposal(t *testing.T) {
+	var (
+		validators, keys = newTestValidators(4)
+		block            = &proto.Block{Header: &proto.Header{Version: 1, Height: 1, PrevHash: util.RandomHash()}}
+	)
+	types.SignBlock(keys[2], block)
+
+	// round 1 of height 1 belongs to the third validator
+	proposal := &proto.Proposal{Height: 1, Round: 1, Block: block}
+	SignProposal(keys[2], proposal)
+	assert.Nil(t, VerifyProposal(validators, proposal))
+
+	proposal.Round = 0
+	assert.ErrorIs(t, VerifyProposal(validators, proposal), ErrWrongProposer)
+	SignProposal(keys[1], proposal)
+	assert.ErrorIs(t, VerifyProposal(validators, proposal), ErrWrongProposer)
+
+	// the round is covered by the signature
+	proposal = &proto.Proposal{Height: 1, Round: 1, Block: block}
+	SignProposal(keys[2], proposal)
+	proposal.Round = 5
+	assert.ErrorIs(t, VerifyProposal(validators, proposal), ErrInvalidVote)
+}
@@ -0,0 +1,129 @@
+package consensus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"time"
+)
+
+// Names of the engines a genesis file can select
+const (
+	EnginePoA = "poa"
+	EnginePoW = "pow"
+	EngineBFT = "bft"
+)
+
+var (
+	ErrNotProposer   = errors.New("not allowed to propose")
+	ErrWrongProposer = errors.New("block signed by the wrong proposer")
+	ErrOutsideSlot   = errors.New("block produced outside its slot")
+	ErrInvalidSeal   = errors.New("invalid seal")
+
+	// ErrFutureBlock is returned along with ErrOutsideSlot for blocks that
+	// are only early, they may be valid once their time has come
+	ErrFutureBlock = errors.New("block timestamp is in the future")
+)
+
+// ChainReader gives an engine read access to the chain it runs on
+type ChainReader interface {
+	// Params returns the consensus parameters of the network
+	Params() types.ConsensusParams
+
+	// GetHeader returns the header of the known block with the given hash,
+	// or nil if the block is unknown
+	GetHeader(hash []byte) *proto.Header
+
+	// Validators returns the validator set of the block following parent
+	Validators(parent *proto.Header) [][]byte
+}
+
+// Engine decides who may produce blocks and when a block is acceptable. The
+// chain asks the engine to verify every block it receives, the node uses the
+// engine to produce its own blocks.
+type Engine interface {
+	// Authorized returns true if the key may produce the block following parent
+	// at all
+	Authorized(chain ChainReader, parent *proto.Header, pubKey []byte) bool
+
+	// Prepare sets the consensus fields of a new header on top of parent. It
+	// returns ErrNotProposer if the key may not produce the block at the
+	// given time.
+	Prepare(chain ChainReader, parent, header *proto.Header, pubKey []byte, now time.Time) error
+
+	// Finalize completes a block once its transactions are set
+	Finalize(chain ChainReader, block *proto.Block)
+
+	// Seal seals the finalized block with the key, so the network accepts
+	// it. Seal may take long, it gives up once stop is closed.
+	Seal(chain ChainReader, block *proto.Block, key *crypto.PrivateKey, stop <-chan struct{}) error
+
+	// VerifyHeader checks the consensus fields of the header against its parent
+	VerifyHeader(chain ChainReader, parent, header *proto.Header, now time.Time) error
+
+	// VerifySeal checks that the block on top of parent was sealed correctly
+	VerifySeal(chain ChainReader, parent *proto.Header, block *proto.Block) error
+}
+
+// Finality is implemented by engines whose blocks become final once a quorum
+// of validators commits to them.
+type Finality interface {
+	// VerifyCommit checks that the certificate commits the block of the header
+	VerifyCommit(chain ChainReader, header *proto.Header, cert *proto.CommitCertificate) error
+}
+
+// New creates the engine selected by the consensus parameters
+func New(params types.ConsensusParams) (Engine, error) {
+	switch params.Engine {
+	case "", EnginePoA:
+		return NewPoA(params.BlockInterval(), params.Timeout()), nil
+	case EnginePoW:
+		if params.PowBits <= 0 || params.PowBits > 63 {
+			return nil, fmt.Errorf("invalid proof-of-work bits %d", params.PowBits)
+		}
+		if params.RetargetInterval < 2 {
+			return nil, fmt.Errorf("invalid retarget interval %d", params.RetargetInterval)
+		}
+		return NewPoW(1<<params.PowBits, params.RetargetInterval, params.BlockInterval()), nil
+	case EngineBFT:
+		return NewBFT(params.BlockInterval(), params.Timeout()), nil
+	default:
+		return nil, fmt.Errorf("unknown consensus engine %q", params.Engine)
+	}
+}
+
+// Proposer returns the validator of the set proposing in the given round of
+// the given height. The validators take turns by height and round.
+func Proposer(validators [][]byte, height, round int) []byte {
+	return validators[(height+round)%len(validators)]
+}
+
+// IsValidator returns true if the public key is in the validator set
+func IsValidator(validators [][]byte, pubKey []byte) bool {
+	for _, validator := range validators {
+		if bytes.Equal(validator, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// finalize sets the merkle root of the transactions and the hash of the
+// evidence of the block
+func finalize(block *proto.Block) {
+	if tree := types.GetMerkleTree(block); tree != nil {
+		block.Header.RootHash = tree.MerkleRoot()
+	}
+	block.Header.EvidenceHash = types.HashEvidence(block.Evidence)
+}
+
+// verifySignature checks the signature of the producer of the block
+func verifySignature(block *proto.Block) error {
+	if !types.VerifyBlock(block) {
+		return fmt.Errorf("%w: block signature is invalid", ErrInvalidSeal)
+	}
+	return nil
+}
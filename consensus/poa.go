@@ -0,0 +1,114 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"time"
+)
+
+// PoA is the proof-of-authority engine. The validators take turns by height.
+// The validator scheduled for a height has to produce its block in the first
+// timeout after the block interval, every further timeout hands the slot to
+// the next validator, so an offline validator only delays the chain.
+//
+// Without validators the network is open and any key may produce blocks.
+type PoA struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func NewPoA(interval, timeout time.Duration) *PoA {
+	return &PoA{
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Authorized returns true if the public key belongs to the validator set
+func (p *PoA) Authorized(chain ChainReader, parent *proto.Header, pubKey []byte) bool {
+	validators := chain.Validators(parent)
+	return len(validators) == 0 || IsValidator(validators, pubKey)
+}
+
+// Round returns the round a block produced at the given time on top of parent
+// belongs to. Blocks produced before the block interval has passed do not
+// belong to any round.
+func (p *PoA) Round(parent *proto.Header, timestamp int64) (int, bool) {
+	delay := time.Duration(timestamp-parent.Timestamp) - p.interval
+	if delay < 0 {
+		return 0, false
+	}
+	return int(delay / p.timeout), true
+}
+
+// Prepare stamps the header with the given time if the slot belongs to the key
+func (p *PoA) Prepare(chain ChainReader, parent, header *proto.Header, pubKey []byte, now time.Time) error {
+	height := int(parent.Height) + 1
+	if validators := chain.Validators(parent); len(validators) > 0 {
+		round, ok := p.Round(parent, now.UnixNano())
+		if !ok {
+			return fmt.Errorf("%w: block interval has not passed", ErrNotProposer)
+		}
+		if proposer := Proposer(validators, height, round); !bytes.Equal(proposer, pubKey) {
+			return fmt.Errorf("%w: round %d of height %d belongs to %x", ErrNotProposer, round, height, proposer)
+		}
+	}
+
+	header.Height = int32(height)
+	header.Timestamp = now.UnixNano()
+	return nil
+}
+
+// Finalize sets the merkle root and the evidence hash of the block
+func (p *PoA) Finalize(chain ChainReader, block *proto.Block) {
+	finalize(block)
+}
+
+// Seal signs the block
+func (p *PoA) Seal(chain ChainReader, block *proto.Block, key *crypto.PrivateKey, stop <-chan struct{}) error {
+	types.SignBlock(key, block)
+	return nil
+}
+
+// VerifyHeader checks that the timestamp of the header falls in a slot. The
+// timestamp may not be ahead of now by more than a timeout, so nobody can
+// claim a slot that has not started yet.
+func (p *PoA) VerifyHeader(chain ChainReader, parent, header *proto.Header, now time.Time) error {
+	if len(chain.Validators(parent)) == 0 {
+		return nil
+	}
+
+	if header.Timestamp > now.Add(p.timeout).UnixNano() {
+		return fmt.Errorf("%w: %w", ErrOutsideSlot, ErrFutureBlock)
+	}
+	if _, ok := p.Round(parent, header.Timestamp); !ok {
+		return fmt.Errorf("%w: block produced before the block interval passed", ErrOutsideSlot)
+	}
+	return nil
+}
+
+// VerifySeal checks that the block was signed by the validator whose slot its
+// timestamp falls in.
+func (p *PoA) VerifySeal(chain ChainReader, parent *proto.Header, block *proto.Block) error {
+	if err := verifySignature(block); err != nil {
+		return err
+	}
+	validators := chain.Validators(parent)
+	if len(validators) == 0 {
+		return nil
+	}
+
+	round, ok := p.Round(parent, block.Header.Timestamp)
+	if !ok {
+		return fmt.Errorf("%w: block produced before the block interval passed", ErrOutsideSlot)
+	}
+
+	height := int(parent.Height) + 1
+	if proposer := Proposer(validators, height, round); !bytes.Equal(proposer, block.PublicKey) {
+		return fmt.Errorf("%w: round %d of height %d belongs to %x", ErrWrongProposer, round, height, proposer)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package consensus
+
+import (
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPoAProposer(t *testing.T) {
+	var (
+		a          = []byte{1}
+		b          = []byte{2}
+		c          = []byte{3}
+		validators = [][]byte{a, b, c}
+		poa        = NewPoA(5*time.Second, 10*time.Second)
+	)
+
+	assert.Equal(t, b, Proposer(validators, 1, 0))
+	assert.Equal(t, c, Proposer(validators, 2, 0))
+	assert.Equal(t, a, Proposer(validators, 3, 0))
+	assert.Equal(t, c, Proposer(validators, 1, 1))
+	assert.Equal(t, a, Proposer(validators, 1, 2))
+
+	parent := &proto.Header{Timestamp: 0}
+	_, ok := poa.Round(parent, int64(4*time.Second))
+	assert.False(t, ok)
+	for delay, expected := range map[time.Duration]int{
+		5 * time.Second:  0,
+		14 * time.Second: 0,
+		15 * time.Second: 1,
+		36 * time.Second: 3,
+	} {
+		round, ok := poa.Round(parent, int64(delay))
+		assert.True(t, ok)
+		assert.Equal(t, expected, round, delay)
+	}
+}
+
+func TestPoAPrepareAndVerify(t *testing.T) {
+	var (
+		keys   = []*crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+		chain  = &testChain{validators: [][]byte{keys[0].PublicKey().Bytes(), keys[1].PublicKey().Bytes()}}
+		poa    = NewPoA(5*time.Second, 10*time.Second)
+		parent = &proto.Header{Height: 4, Timestamp: time.Now().Add(-6 * time.Second).UnixNano()}
+		now    = time.Now()
+	)
+
+	assert.True(t, poa.Authorized(chain, parent, keys[0].PublicKey().Bytes()))
+	assert.False(t, poa.Authorized(chain, parent, crypto.GeneratePrivateKey().PublicKey().Bytes()))
+	assert.True(t, poa.Authorized(&testChain{}, parent, crypto.GeneratePrivateKey().PublicKey().Bytes()))
+
+	header := &proto.Header{}
+	assert.ErrorIs(t, poa.Prepare(chain, parent, header, keys[0].PublicKey().Bytes(), now), ErrNotProposer)
+	require.Nil(t, poa.Prepare(chain, parent, header, keys[1].PublicKey().Bytes(), now))
+	assert.Equal(t, int32(5), header.Height)
+	assert.Equal(t, now.UnixNano(), header.Timestamp)
+
+	block := &proto.Block{Header: header}
+	poa.Finalize(chain, block)
+	require.Nil(t, poa.Seal(chain, block, keys[1], nil))
+	assert.Nil(t, poa.VerifyHeader(chain, parent, header, now))
+	assert.Nil(t, poa.VerifySeal(chain, parent, block))
+
+	types.SignBlock(keys[0], block)
+	assert.ErrorIs(t, poa.VerifySeal(chain, parent, block), ErrWrongProposer)
+
+	block.Signature = nil
+	assert.ErrorIs(t, poa.VerifySeal(chain, parent, block), ErrInvalidSeal)
+}
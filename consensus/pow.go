@@ -0,0 +1,197 @@
+package consensus
+
+import (
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	pb "github.com/golang/protobuf/proto"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRetargetFactor bounds how much the difficulty may change in one retarget
+const maxRetargetFactor = 4
+
+// two256 is 2^256, the target of a block with difficulty 1
+var two256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// PoW is the proof-of-work engine. Anybody may produce a block by finding a
+// nonce that makes the header hash fall below the target of the header's
+// difficulty. Every retarget interval the difficulty is adjusted so blocks
+// follow each other at the block interval.
+type PoW struct {
+	initial  uint64
+	retarget int
+	interval time.Duration
+	workers  int
+}
+
+// NewPoW creates an engine starting at the given difficulty, retargeting
+// every retarget blocks toward the block interval.
+func NewPoW(initial uint64, retarget int, interval time.Duration) *PoW {
+	return &PoW{
+		initial:  initial,
+		retarget: retarget,
+		interval: interval,
+		workers:  runtime.NumCPU(),
+	}
+}
+
+// Target returns the value a header hash has to be below at the given difficulty
+func Target(difficulty uint64) *big.Int {
+	if difficulty == 0 {
+		difficulty = 1
+	}
+	return new(big.Int).Div(two256, new(big.Int).SetUint64(difficulty))
+}
+
+// Authorized returns true, everybody may mine
+func (p *PoW) Authorized(chain ChainReader, parent *proto.Header, pubKey []byte) bool {
+	return true
+}
+
+// Prepare stamps the header with the given time and the difficulty it has to
+// be mined at.
+func (p *PoW) Prepare(chain ChainReader, parent, header *proto.Header, pubKey []byte, now time.Time) error {
+	difficulty, err := p.NextDifficulty(chain, parent)
+	if err != nil {
+		return err
+	}
+
+	header.Height = parent.Height + 1
+	header.Timestamp = now.UnixNano()
+	header.Difficulty = difficulty
+	return nil
+}
+
+// NextDifficulty returns the difficulty of the block following parent. The
+// difficulty only changes at multiples of the retarget interval, where it is
+// scaled by how much faster or slower than planned the last interval was.
+func (p *PoW) NextDifficulty(chain ChainReader, parent *proto.Header) (uint64, error) {
+	if parent.Height == 0 {
+		return p.initial, nil
+	}
+	if int(parent.Height+1)%p.retarget != 0 {
+		return parent.Difficulty, nil
+	}
+
+	// walk back to the first block of the interval
+	first := parent
+	for i := 0; i < p.retarget-1; i++ {
+		prev := chain.GetHeader(first.PrevHash)
+		if prev == nil {
+			return 0, fmt.Errorf("header %x is unknown", first.PrevHash)
+		}
+		first = prev
+	}
+
+	var (
+		expected = int64(p.interval) * int64(p.retarget-1)
+		actual   = parent.Timestamp - first.Timestamp
+	)
+	if actual < expected/maxRetargetFactor {
+		actual = expected / maxRetargetFactor
+	}
+	if actual > expected*maxRetargetFactor {
+		actual = expected * maxRetargetFactor
+	}
+
+	next := new(big.Int).SetUint64(parent.Difficulty)
+	next.Mul(next, big.NewInt(expected))
+	next.Div(next, big.NewInt(actual))
+	if next.Sign() == 0 {
+		return 1, nil
+	}
+	if !next.IsUint64() {
+		return math.MaxUint64, nil
+	}
+	return next.Uint64(), nil
+}
+
+// Finalize sets the merkle root and the evidence hash of the block
+func (p *PoW) Finalize(chain ChainReader, block *proto.Block) {
+	finalize(block)
+}
+
+// Seal searches a nonce for the header on all cores and signs the block. Every
+// worker tries the nonces equal to its index modulo the number of workers.
+func (p *PoW) Seal(chain ChainReader, block *proto.Block, key *crypto.PrivateKey, stop <-chan struct{}) error {
+	var (
+		pool   = util.NewWorkerPool(p.workers, p.workers)
+		target = Target(block.Header.Difficulty)
+		done   = make(chan struct{})
+		once   sync.Once
+		found  atomic.Bool
+		nonce  uint64
+	)
+	defer pool.Stop()
+
+	for i := 0; i < p.workers; i++ {
+		header := pb.Clone(block.Header).(*proto.Header)
+		start := uint64(i)
+		pool.Submit(func() {
+			for n := start; ; n += uint64(p.workers) {
+				select {
+				case <-stop:
+					return
+				case <-done:
+					return
+				default:
+				}
+
+				header.Nonce = n
+				if new(big.Int).SetBytes(types.HashHeader(header)).Cmp(target) < 0 {
+					once.Do(func() {
+						nonce = n
+						found.Store(true)
+						close(done)
+					})
+					return
+				}
+			}
+		})
+	}
+	pool.Wait()
+
+	if !found.Load() {
+		return fmt.Errorf("sealing stopped")
+	}
+	block.Header.Nonce = nonce
+	types.SignBlock(key, block)
+	return nil
+}
+
+// VerifyHeader checks that the header is not older than its parent and
+// carries the difficulty the chain requires.
+func (p *PoW) VerifyHeader(chain ChainReader, parent, header *proto.Header, now time.Time) error {
+	if header.Timestamp < parent.Timestamp {
+		return fmt.Errorf("%w: block is older than its parent", ErrInvalidSeal)
+	}
+
+	difficulty, err := p.NextDifficulty(chain, parent)
+	if err != nil {
+		return err
+	}
+	if header.Difficulty != difficulty {
+		return fmt.Errorf("%w: difficulty is %d, expected %d", ErrInvalidSeal, header.Difficulty, difficulty)
+	}
+	return nil
+}
+
+// VerifySeal checks the signature of the block and its proof of work
+func (p *PoW) VerifySeal(chain ChainReader, parent *proto.Header, block *proto.Block) error {
+	if err := verifySignature(block); err != nil {
+		return err
+	}
+	hash := new(big.Int).SetBytes(types.HashHeader(block.Header))
+	if hash.Cmp(Target(block.Header.Difficulty)) >= 0 {
+		return fmt.Errorf("%w: header hash is above the target", ErrInvalidSeal)
+	}
+	return nil
+}
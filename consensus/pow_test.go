@@ -0,0 +1,153 @@
+package consensus
+
+import (
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testChain is a ChainReader over a list of headers
+type testChain struct {
+	headers    map[string]*proto.Header
+	validators [][]byte
+}
+
+func (c *testChain) Params() types.ConsensusParams {
+	return types.DefaultConsensusParams()
+}
+
+func (c *testChain) GetHeader(hash []byte) *proto.Header {
+	return c.headers[hex.EncodeToString(hash)]
+}
+
+func (c *testChain) Validators(parent *proto.Header) [][]byte {
+	return c.validators
+}
+
+// buildHeaders returns a chain of count headers following each other at the
+// given spacing and difficulty, starting with a genesis header.
+func buildHeaders(count int, spacing time.Duration, difficulty uint64) (*testChain, *proto.Header) {
+	var (
+		chain = &testChain{headers: make(map[string]*proto.Header)}
+		tip   = &proto.Header{Version: 1}
+	)
+	chain.headers[hex.EncodeToString(types.HashHeader(tip))] = tip
+	for i := 1; i < count; i++ {
+		header := &proto.Header{
+			Version:    1,
+			Height:     tip.Height + 1,
+			PrevHash:   types.HashHeader(tip),
+			Timestamp:  tip.Timestamp + int64(spacing),
+			Difficulty: difficulty,
+		}
+		chain.headers[hex.EncodeToString(types.HashHeader(header))] = header
+		tip = header
+	}
+	return chain, tip
+}
+
+func TestPoWNextDifficulty(t *testing.T) {
+	pow := NewPoW(1000, 10, 5*time.Second)
+
+	chain, genesis := buildHeaders(1, 0, 0)
+	difficulty, err := pow.NextDifficulty(chain, genesis)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(1000), difficulty)
+
+	// no retarget before the end of the interval
+	chain, tip := buildHeaders(9, time.Second, 1000)
+	difficulty, err = pow.NextDifficulty(chain, tip)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(1000), difficulty)
+
+	for spacing, expected := range map[time.Duration]uint64{
+		5 * time.Second:         1000,
+		10 * time.Second:        500,
+		2500 * time.Millisecond: 2000,
+		time.Millisecond:        4000, // clamped
+		time.Minute:             250,  // clamped
+	} {
+		chain, tip := buildHeaders(10, spacing, 1000)
+		difficulty, err := pow.NextDifficulty(chain, tip)
+		require.Nil(t, err)
+		assert.Equal(t, expected, difficulty, spacing)
+	}
+}
+
+func TestPoWSeal(t *testing.T) {
+	var (
+		pow         = NewPoW(1<<12, 10, 5*time.Second)
+		key         = crypto.GeneratePrivateKey()
+		chain, tip  = buildHeaders(5, 5*time.Second, 1<<12)
+		header      = &proto.Header{PrevHash: types.HashHeader(tip)}
+		parentCount = len(chain.headers)
+	)
+	require.Nil(t, pow.Prepare(chain, tip, header, key.PublicKey().Bytes(), time.Unix(0, tip.Timestamp).Add(time.Second)))
+	assert.Equal(t, int32(5), header.Height)
+	assert.Equal(t, uint64(1<<12), header.Difficulty)
+	assert.Equal(t, parentCount, len(chain.headers))
+
+	block := &proto.Block{Header: header}
+	pow.Finalize(chain, block)
+	require.Nil(t, pow.Seal(chain, block, key, nil))
+	assert.Nil(t, pow.VerifyHeader(chain, tip, header, time.Now()))
+	assert.Nil(t, pow.VerifySeal(chain, tip, block))
+	assert.Equal(t, -1, new(big.Int).SetBytes(types.HashBlock(block)).Cmp(Target(header.Difficulty)))
+
+	// the seal commits to the nonce
+	for new(big.Int).SetBytes(types.HashHeader(block.Header)).Cmp(Target(header.Difficulty)) < 0 {
+		block.Header.Nonce++
+	}
+	types.SignBlock(key, block)
+	assert.ErrorIs(t, pow.VerifySeal(chain, tip, block), ErrInvalidSeal)
+
+	// the difficulty is set by the chain, not by the miner
+	header.Difficulty = 1
+	assert.ErrorIs(t, pow.VerifyHeader(chain, tip, header, time.Now()), ErrInvalidSeal)
+}
+
+func TestPoWSealStop(t *testing.T) {
+	var (
+		pow   = NewPoW(1<<63, 10, 5*time.Second)
+		block = &proto.Block{Header: &proto.Header{Difficulty: 1 << 63}}
+		stop  = make(chan struct{})
+	)
+	close(stop)
+	assert.NotNil(t, pow.Seal(nil, block, crypto.GeneratePrivateKey(), stop))
+}
+
+func TestNew(t *testing.T) {
+	params := types.DefaultConsensusParams()
+	engine, err := New(params)
+	require.Nil(t, err)
+	assert.IsType(t, &PoA{}, engine)
+
+	params.Engine = EnginePoW
+	engine, err = New(params)
+	require.Nil(t, err)
+	assert.IsType(t, &PoW{}, engine)
+
+	params.RetargetInterval = 1
+	_, err = New(params)
+	assert.NotNil(t, err)
+
+	params.RetargetInterval = 10
+	params.PowBits = 64
+	_, err = New(params)
+	assert.NotNil(t, err)
+
+	params.Engine = EngineBFT
+	engine, err = New(params)
+	require.Nil(t, err)
+	assert.IsType(t, &BFT{}, engine)
+
+	params.Engine = "pos"
+	_, err = New(params)
+	assert.NotNil(t, err)
+}
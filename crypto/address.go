@@ -0,0 +1,203 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AddressVersion is the version of the address derivation. It is hashed
+// with the public key and is the first symbol of the data of an encoded
+// address.
+const AddressVersion = 0
+
+// Human readable parts of the encoded addresses of the networks
+const (
+	MainnetHRP = "blk"
+	TestnetHRP = "tblk"
+)
+
+var (
+	// ErrInvalidAddress is returned for text that is not an encoded address,
+	// including addresses with a bad checksum
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrWrongNetwork is returned for addresses of another network
+	ErrWrongNetwork = errors.New("address of another network")
+)
+
+// Encode returns the address encoded with bech32m for the network with the
+// given human readable part, for example tblk1q... on the test network. The
+// checksum catches typos, the human readable part sends to the wrong network.
+// Encode panics on an invalid human readable part.
+func (a Address) Encode(hrp string) string {
+	if !ValidHRP(hrp) {
+		panic(fmt.Sprintf("invalid address hrp %q", hrp))
+	}
+	data, err := convertBits(a.addr, 8, 5, true)
+	if err != nil {
+		panic(err)
+	}
+	return bech32Encode(hrp, append([]byte{AddressVersion}, data...))
+}
+
+// ParseAddress parses an address of the network with the given human
+// readable part, as written by Encode. Upper case addresses are accepted,
+// mixed case ones are not.
+func ParseAddress(s string, hrp string) (Address, error) {
+	prefix, data, err := bech32Decode(s)
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: %s", ErrInvalidAddress, err)
+	}
+	if prefix != hrp {
+		return Address{}, fmt.Errorf("%w: %s is not a %s address", ErrWrongNetwork, s, hrp)
+	}
+	if len(data) == 0 || data[0] != AddressVersion {
+		return Address{}, fmt.Errorf("%w: unknown address version", ErrInvalidAddress)
+	}
+
+	addr, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: %s", ErrInvalidAddress, err)
+	}
+	if len(addr) != AddressLen {
+		return Address{}, fmt.Errorf("%w: address has %d bytes", ErrInvalidAddress, len(addr))
+	}
+	return Address{addr: addr}, nil
+}
+
+// ValidHRP returns true if the human readable part can be used in addresses:
+// 1 to 83 lower case printable ASCII characters
+func ValidHRP(hrp string) bool {
+	if len(hrp) == 0 || len(hrp) > 83 {
+		return false
+	}
+	for i := 0; i < len(hrp); i++ {
+		if c := hrp[i]; c < 33 || c > 126 || c >= 'A' && c <= 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Bech32m as specified by BIP 350: the human readable part, the separator 1
+// and the data in 5 bit symbols followed by a 6 symbol checksum.
+const (
+	bech32Charset  = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32mConst   = 0x2bc830a3
+	bech32MaxLen   = 90
+	bech32Checksum = 6
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Generator {
+			if (top>>i)&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// bech32Values returns the symbols the checksum is computed over, the high
+// and low bits of the human readable part followed by the data
+func bech32Values(hrp string, data []byte) []byte {
+	values := make([]byte, 0, 2*len(hrp)+1+len(data)+bech32Checksum)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return append(values, data...)
+}
+
+func bech32Encode(hrp string, data []byte) string {
+	values := append(bech32Values(hrp, data), make([]byte, bech32Checksum)...)
+	mod := bech32Polymod(values) ^ bech32mConst
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range data {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < bech32Checksum; i++ {
+		sb.WriteByte(bech32Charset[mod>>(5*(bech32Checksum-1-i))&31])
+	}
+	return sb.String()
+}
+
+// bech32Decode returns the human readable part and the data of a bech32m
+// string, without the checksum
+func bech32Decode(s string) (string, []byte, error) {
+	if len(s) > bech32MaxLen {
+		return "", nil, fmt.Errorf("%d characters", len(s))
+	}
+	lower := strings.ToLower(s)
+	if s != lower && s != strings.ToUpper(s) {
+		return "", nil, errors.New("mixed case")
+	}
+	s = lower
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+1+bech32Checksum > len(s) {
+		return "", nil, errors.New("missing separator or checksum")
+	}
+	hrp := s[:sep]
+	if !ValidHRP(hrp) {
+		return "", nil, fmt.Errorf("invalid hrp %q", hrp)
+	}
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", s[i])
+		}
+		data = append(data, byte(v))
+	}
+	if bech32Polymod(bech32Values(hrp, data)) != bech32mConst {
+		return "", nil, errors.New("bad checksum")
+	}
+	return hrp, data[:len(data)-bech32Checksum], nil
+}
+
+// convertBits regroups the bits of data from groups of from bits into groups
+// of to bits. Without padding the bits left over have to be zero and fewer
+// than from.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var (
+		acc  uint32
+		bits uint
+		out  []byte
+		mask = uint32(1)<<to - 1
+	)
+	for _, v := range data {
+		if v>>from != 0 {
+			return nil, fmt.Errorf("value %d has more than %d bits", v, from)
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&mask))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&mask))
+		}
+	} else if bits >= from || acc<<(to-bits)&mask != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
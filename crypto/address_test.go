@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestBech32m(t *testing.T) {
+	// valid bech32m strings of BIP 350
+	for _, s := range []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	} {
+		hrp, data, err := bech32Decode(s)
+		require.Nil(t, err, s)
+		assert.Equal(t, strings.ToLower(s), bech32Encode(hrp, data), s)
+	}
+
+	for _, s := range []string{
+		"a12uel5l",   // bech32, not bech32m
+		"a1lqfn3q",   // bad checksum
+		"A1lqfn3a",   // mixed case
+		"1lqfn3a",    // no hrp
+		"a1lqfn3",    // short checksum
+		"a1lqfn3b",   // invalid character
+		"a\x7f1qnj2", // invalid hrp
+	} {
+		_, _, err := bech32Decode(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestAddressEncoding(t *testing.T) {
+	var (
+		pub  = GeneratePrivateKey().PublicKey()
+		addr = pub.Address()
+	)
+	hash := sha256.Sum256(append([]byte{AddressVersion}, pub.Bytes()...))
+	assert.Equal(t, hash[:AddressLen], addr.Bytes())
+
+	encoded := addr.Encode(MainnetHRP)
+	assert.True(t, strings.HasPrefix(encoded, MainnetHRP+"1q"))
+	assert.Equal(t, hex.EncodeToString(addr.Bytes()), addr.String())
+
+	parsed, err := ParseAddress(encoded, MainnetHRP)
+	require.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+	parsed, err = ParseAddress(strings.ToUpper(encoded), MainnetHRP)
+	require.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	// every single character typo is caught by the checksum
+	for i := len(MainnetHRP) + 1; i < len(encoded); i++ {
+		for _, c := range bech32Charset {
+			if byte(c) == encoded[i] {
+				continue
+			}
+			typo := encoded[:i] + string(c) + encoded[i+1:]
+			_, err := ParseAddress(typo, MainnetHRP)
+			require.ErrorIs(t, err, ErrInvalidAddress, typo)
+		}
+	}
+
+	_, err = ParseAddress(encoded, TestnetHRP)
+	assert.ErrorIs(t, err, ErrWrongNetwork)
+	_, err = ParseAddress(addr.Encode(TestnetHRP), MainnetHRP)
+	assert.ErrorIs(t, err, ErrWrongNetwork)
+	_, err = ParseAddress(addr.String(), MainnetHRP)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	// other versions and lengths are no addresses
+	data, err := convertBits(addr.Bytes(), 8, 5, true)
+	require.Nil(t, err)
+	for _, invalid := range [][]byte{
+		append([]byte{AddressVersion + 1}, data...),
+		append([]byte{AddressVersion}, data[1:]...),
+		{AddressVersion},
+	} {
+		_, err := ParseAddress(bech32Encode(MainnetHRP, invalid), MainnetHRP)
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+	}
+
+	assert.False(t, ValidHRP(""))
+	assert.False(t, ValidHRP("Blk"))
+	assert.Panics(t, func() { addr.Encode("") })
+}
@@ -3,6 +3,7 @@ package crypto
 import (
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"io"
 )
@@ -66,9 +67,11 @@ type PublicKey struct {
 	key ed25519.PublicKey
 }
 
-// Address ...
+// Address returns the address of the public key, the first AddressLen bytes
+// of the sha256 hash of AddressVersion followed by the key.
 func (k *PublicKey) Address() Address {
-	return Address{addr: k.key[len(k.key)-AddressLen:]}
+	hash := sha256.Sum256(append([]byte{AddressVersion}, k.key...))
+	return Address{addr: hash[:AddressLen]}
 }
 
 // Bytes returns the public key as a byte slice.
@@ -115,6 +118,8 @@ func (a Address) Bytes() []byte {
 	return a.addr
 }
 
+// String returns the address bytes in hex. It names no network, addresses
+// shown to users are written by Encode.
 func (a Address) String() string {
 	return hex.EncodeToString(a.addr)
 }
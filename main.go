@@ -1,49 +1,183 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
 	"github.com/fzft/crypto-prd-blockchain/crypto"
 	"github.com/fzft/crypto-prd-blockchain/node"
 	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
 	"github.com/fzft/crypto-prd-blockchain/util"
 	"google.golang.org/grpc"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
 func main() {
-	makeNode(":3000", true)
-	makeNode(":3001", false, ":3000")
+	genesisPath := flag.String("genesis", "", "path of the genesis file, a local devnet is started if empty")
+	keyPath := flag.String("key", "", "file with the hex seed of the validator key, created if missing, defaults to validator.key in the datadir")
+	dataDir := flag.String("datadir", "", "directory the nodes keep their chains in, one subdirectory per node, chains are kept in memory if empty")
+	flag.Parse()
+
+	if *keyPath == "" && *dataDir != "" {
+		*keyPath = filepath.Join(*dataDir, "validator.key")
+	}
+	validatorKey, err := loadKey(*keyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	genesis, err := loadGenesis(*genesisPath, *dataDir, validatorKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if genesis.Consensus.Engine != consensus.EnginePoW && !isValidator(genesis, validatorKey) {
+		log.Fatalf("validator key %x is not a validator of the genesis, pass its key with -key", validatorKey.PublicKey().Bytes())
+	}
+
+	makeNode(genesis, *dataDir, ":3000", validatorKey)
+	makeNode(genesis, *dataDir, ":3001", nil, ":3000")
 
 	time.Sleep(2 * time.Second)
-	makeNode(":3002", false, ":3001")
+	makeNode(genesis, *dataDir, ":3002", nil, ":3001")
 
 	for {
 		time.Sleep(800 * time.Millisecond)
-		makeTransaction()
+		if err := makeTransaction(); err != nil {
+			log.Printf("transaction rejected - %s", err)
+		}
+	}
+}
+
+// loadKey reads the validator key from the hex seed in the file at path. A
+// new key is written to the file if it does not exist, without a path the key
+// is not kept at all.
+func loadKey(path string) (*crypto.PrivateKey, error) {
+	if path == "" {
+		return crypto.GeneratePrivateKey(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := crypto.GeneratePrivateKey()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		seed := hex.EncodeToString(key.Bytes()[:crypto.SeedLen])
+		return key, os.WriteFile(path, []byte(seed+"\n"), 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != crypto.SeedLen {
+		return nil, fmt.Errorf("%s does not hold the hex seed of a key", path)
+	}
+	return crypto.GeneratePrivateKeyFromSeed(seed), nil
+}
+
+// loadGenesis loads the genesis file at path. Without a path the devnet of
+// the validator is started, its genesis is kept in the data dir so the devnet
+// can be restarted on the stored chains.
+func loadGenesis(path string, dataDir string, validator *crypto.PrivateKey) (*node.Genesis, error) {
+	if path != "" {
+		return node.LoadGenesis(path)
+	}
+	if dataDir == "" {
+		return devnetGenesis(validator), nil
 	}
 
-	select {}
+	path = filepath.Join(dataDir, "genesis.json")
+	genesis, err := node.LoadGenesis(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return genesis, err
+	}
+	genesis = devnetGenesis(validator)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	return genesis, genesis.Save(path)
+}
 
+// isValidator returns true if the key is in the validator set of the genesis
+func isValidator(genesis *node.Genesis, key *crypto.PrivateKey) bool {
+	for _, validator := range genesis.Validators {
+		if bytes.Equal(validator, key.PublicKey().Bytes()) {
+			return true
+		}
+	}
+	return false
 }
 
-func makeNode(listenAddr string, isValidator bool, bootstrapNodes ...string) *node.Node {
+// devnetGenesis returns the genesis of a local network run by the given validator
+func devnetGenesis(validator *crypto.PrivateKey) *node.Genesis {
+	genesis := &node.Genesis{
+		ChainID:    "blocker-devnet",
+		Timestamp:  time.Now().UTC(),
+		Validators: []node.HexBytes{validator.PublicKey().Bytes()},
+		Consensus:  types.DefaultConsensusParams(),
+	}
+	genesis.Alloc = []node.GenesisAlloc{
+		{Address: validator.PublicKey().Address().Encode(genesis.HRP()), Amount: 1000},
+	}
+	return genesis
+}
+
+func makeNode(genesis *node.Genesis, dataDir string, listenAddr string, prvKey *crypto.PrivateKey, bootstrapNodes ...string) *node.Node {
 	cfg := node.ServerConfig{
 		Version:    "Blocker-1.0",
 		ListenAddr: listenAddr,
+		PrivateKey: prvKey,
+		Genesis:    genesis,
 	}
-
-	if isValidator {
-		cfg.PrivateKey = crypto.GeneratePrivateKey()
+	if dataDir != "" {
+		chain, err := openChain(genesis, filepath.Join(dataDir, strings.TrimPrefix(listenAddr, ":")))
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Chain = chain
 	}
+
 	n := node.New(cfg)
 	go n.Start(listenAddr, bootstrapNodes...)
 	return n
 }
 
-func makeTransaction() {
+// openChain opens the chain kept in the file stores in dir. A chain stored
+// under another genesis is refused.
+func openChain(genesis *node.Genesis, dir string) (*node.Chain, error) {
+	bs, err := node.NewFileBlockStore(filepath.Join(dir, "blocks"))
+	if err != nil {
+		return nil, err
+	}
+	ts, err := node.NewFileTxStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	us, err := node.NewFileUTXOStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	j, err := node.NewFileJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+	return node.NewChain(genesis, bs, ts, us, j)
+}
+
+func makeTransaction() error {
 	client, err := grpc.Dial(":3000", grpc.WithInsecure())
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer client.Close()
 	c := proto.NewNodeClient(client)
@@ -67,7 +201,5 @@ func makeTransaction() {
 	}
 
 	_, err = c.HandleTransaction(context.TODO(), tx)
-	if err != nil {
-		panic(err)
-	}
+	return err
 }
@@ -0,0 +1,304 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	pb "github.com/golang/protobuf/proto"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StoreBatch collects the writes to the block, tx and utxo stores that make
+// up connecting or disconnecting a block, so they can be applied as a whole.
+type StoreBatch struct {
+	blocks      []*proto.Block
+	txs         []*proto.Transaction
+	undo        map[string]*BlockUndo
+	commits     map[string]*proto.CommitCertificate
+	putUTXOs    []*UTXO
+	deleteUTXOs []string
+	putLeaves   map[string][]byte
+	delLeaves   []string
+	bestBlock   string
+}
+
+func NewStoreBatch() *StoreBatch {
+	return &StoreBatch{
+		undo:      make(map[string]*BlockUndo),
+		commits:   make(map[string]*proto.CommitCertificate),
+		putLeaves: make(map[string][]byte),
+	}
+}
+
+func (b *StoreBatch) PutBlock(block *proto.Block) {
+	b.blocks = append(b.blocks, block)
+}
+
+func (b *StoreBatch) PutUndo(hash string, undo *BlockUndo) {
+	b.undo[hash] = undo
+}
+
+func (b *StoreBatch) PutCommit(hash string, cert *proto.CommitCertificate) {
+	b.commits[hash] = cert
+}
+
+func (b *StoreBatch) PutTx(tx *proto.Transaction) {
+	b.txs = append(b.txs, tx)
+}
+
+func (b *StoreBatch) PutUTXO(utxo *UTXO) {
+	b.putUTXOs = append(b.putUTXOs, utxo)
+}
+
+func (b *StoreBatch) DeleteUTXO(key string) {
+	b.deleteUTXOs = append(b.deleteUTXOs, key)
+}
+
+// PutStateLeaf stores the leaf of the utxo in the state tree
+func (b *StoreBatch) PutStateLeaf(utxo *UTXO) {
+	b.putLeaves[hex.EncodeToString(utxoStateKey(utxo))] = stateValue{utxo}.Hash()
+}
+
+// DeleteStateLeaf removes the leaf with the given key from the state tree
+func (b *StoreBatch) DeleteStateLeaf(key []byte) {
+	b.delLeaves = append(b.delLeaves, hex.EncodeToString(key))
+}
+
+func (b *StoreBatch) SetBestBlock(hash string) {
+	b.bestBlock = hash
+}
+
+// apply writes the batch to the stores. Every write is idempotent, so a batch
+// that was only partly applied can simply be applied again. The best block is
+// written last.
+func (b *StoreBatch) apply(bs BlockStore, ts TxStore, us UTXOSore) error {
+	for _, block := range b.blocks {
+		if err := bs.Put(block); err != nil {
+			return err
+		}
+	}
+	for hash, undo := range b.undo {
+		if err := bs.PutUndo(hash, undo); err != nil {
+			return err
+		}
+	}
+	for hash, cert := range b.commits {
+		if err := bs.PutCommit(hash, cert); err != nil {
+			return err
+		}
+	}
+	for _, tx := range b.txs {
+		if err := ts.Put(tx); err != nil {
+			return err
+		}
+	}
+	for _, key := range b.deleteUTXOs {
+		if err := us.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, utxo := range b.putUTXOs {
+		if err := us.Put(utxo); err != nil {
+			return err
+		}
+	}
+	for _, key := range b.delLeaves {
+		if err := us.DeleteStateLeaf(key); err != nil {
+			return err
+		}
+	}
+	for key, hash := range b.putLeaves {
+		if err := us.PutStateLeaf(key, hash); err != nil {
+			return err
+		}
+	}
+	if b.bestBlock != "" {
+		return us.SetBestBlock(b.bestBlock)
+	}
+	return nil
+}
+
+// Journal records a StoreBatch before it is applied, so a batch interrupted
+// by a crash can be detected and applied again on startup.
+type Journal interface {
+	// Begin durably records the batch
+	Begin(*StoreBatch) error
+	// Commit forgets the recorded batch once it is fully applied
+	Commit() error
+	// Pending returns the recorded batch, or nil if there is none
+	Pending() (*StoreBatch, error)
+}
+
+type MemoryJournal struct {
+	lock    sync.Mutex
+	pending *StoreBatch
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{}
+}
+
+func (j *MemoryJournal) Begin(batch *StoreBatch) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.pending = batch
+	return nil
+}
+
+func (j *MemoryJournal) Commit() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.pending = nil
+	return nil
+}
+
+func (j *MemoryJournal) Pending() (*StoreBatch, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.pending, nil
+}
+
+// journalRecord is the on-disk form of a StoreBatch
+type journalRecord struct {
+	Blocks      [][]byte
+	Txs         [][]byte
+	Undo        map[string]*BlockUndo
+	Commits     map[string][]byte
+	PutUTXOs    []*UTXO
+	DeleteUTXOs []string
+	PutLeaves   map[string][]byte
+	DelLeaves   []string
+	BestBlock   string
+}
+
+// FileJournal keeps the pending batch in a journal file. The file is written
+// to a temporary name and renamed, so it is either complete or absent.
+type FileJournal struct {
+	path string
+}
+
+func NewFileJournal(dir string) (*FileJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileJournal{path: filepath.Join(dir, "journal.json")}, nil
+}
+
+func (j *FileJournal) Begin(batch *StoreBatch) error {
+	record := journalRecord{
+		Undo:        batch.undo,
+		PutUTXOs:    batch.putUTXOs,
+		DeleteUTXOs: batch.deleteUTXOs,
+		PutLeaves:   batch.putLeaves,
+		DelLeaves:   batch.delLeaves,
+		BestBlock:   batch.bestBlock,
+		Commits:     make(map[string][]byte, len(batch.commits)),
+	}
+	for _, block := range batch.blocks {
+		data, err := pb.Marshal(block)
+		if err != nil {
+			return err
+		}
+		record.Blocks = append(record.Blocks, data)
+	}
+	for _, tx := range batch.txs {
+		data, err := pb.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		record.Txs = append(record.Txs, data)
+	}
+	for hash, cert := range batch.commits {
+		data, err := pb.Marshal(cert)
+		if err != nil {
+			return err
+		}
+		record.Commits[hash] = data
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := j.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(j.path))
+}
+
+func (j *FileJournal) Commit() error {
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return syncDir(filepath.Dir(j.path))
+}
+
+func (j *FileJournal) Pending() (*StoreBatch, error) {
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record journalRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	batch := NewStoreBatch()
+	for _, data := range record.Blocks {
+		block := new(proto.Block)
+		if err := pb.Unmarshal(data, block); err != nil {
+			return nil, err
+		}
+		batch.PutBlock(block)
+	}
+	for _, data := range record.Txs {
+		tx := new(proto.Transaction)
+		if err := pb.Unmarshal(data, tx); err != nil {
+			return nil, err
+		}
+		batch.PutTx(tx)
+	}
+	for hash, undo := range record.Undo {
+		batch.PutUndo(hash, undo)
+	}
+	for hash, data := range record.Commits {
+		cert := new(proto.CommitCertificate)
+		if err := pb.Unmarshal(data, cert); err != nil {
+			return nil, err
+		}
+		batch.PutCommit(hash, cert)
+	}
+	batch.putUTXOs = record.PutUTXOs
+	batch.deleteUTXOs = record.DeleteUTXOs
+	if record.PutLeaves != nil {
+		batch.putLeaves = record.PutLeaves
+	}
+	batch.delLeaves = record.DelLeaves
+	batch.bestBlock = record.BestBlock
+	return batch, nil
+}
@@ -0,0 +1,154 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// failingUTXOStore fails every write once failPuts puts have gone through
+type failingUTXOStore struct {
+	*MemoryUTXOStore
+	failPuts int
+}
+
+func (s *failingUTXOStore) Put(utxo *UTXO) error {
+	if s.failPuts == 0 {
+		return errors.New("disk full")
+	}
+	s.failPuts--
+	return s.MemoryUTXOStore.Put(utxo)
+}
+
+func TestFileJournal(t *testing.T) {
+	j, err := NewFileJournal(t.TempDir())
+	require.Nil(t, err)
+
+	batch, err := j.Pending()
+	require.Nil(t, err)
+	assert.Nil(t, batch)
+
+	chain := newTestChain(t)
+	block := randomBlock(t, chain)
+	batch = NewStoreBatch()
+	batch.PutBlock(block)
+	batch.PutTx(genesisTx(t, chain))
+	batch.PutUndo("hash", &BlockUndo{Spent: []*UTXO{{Hash: "a", Amount: 1}}})
+	batch.PutUTXO(&UTXO{Hash: "b", OutIndex: 1, Amount: 2})
+	batch.DeleteUTXO("a_0")
+	batch.PutStateLeaf(&UTXO{Hash: "0b", OutIndex: 1, Amount: 2})
+	batch.DeleteStateLeaf(stateKey([]byte{0x0a}, 0))
+	batch.SetBestBlock("hash")
+	require.Nil(t, j.Begin(batch))
+
+	pending, err := j.Pending()
+	require.Nil(t, err)
+	require.Len(t, pending.blocks, 1)
+	assert.Equal(t, block.Header.Height, pending.blocks[0].Header.Height)
+	assert.Len(t, pending.txs, 1)
+	assert.Equal(t, batch.undo, pending.undo)
+	assert.Equal(t, batch.putUTXOs, pending.putUTXOs)
+	assert.Equal(t, batch.deleteUTXOs, pending.deleteUTXOs)
+	assert.Equal(t, batch.putLeaves, pending.putLeaves)
+	assert.Equal(t, batch.delLeaves, pending.delLeaves)
+	assert.Equal(t, "hash", pending.bestBlock)
+
+	require.Nil(t, j.Commit())
+	pending, err = j.Pending()
+	require.Nil(t, err)
+	assert.Nil(t, pending)
+}
+
+// failingBlockStore fails every block write while fail is set
+type failingBlockStore struct {
+	*MemoryBlockStore
+	fail bool
+}
+
+func (s *failingBlockStore) Put(block *proto.Block) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryBlockStore.Put(block)
+}
+
+func TestChainRecoverSideBranch(t *testing.T) {
+	var (
+		bs = &failingBlockStore{MemoryBlockStore: NewMemoryBlockStore()}
+		us = NewMemoryUTXOStore()
+		ts = NewMemoryTxStore()
+		j  = NewMemoryJournal()
+	)
+	chain, err := NewChain(testGenesis(), bs, ts, us, j)
+	require.Nil(t, err)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	require.Nil(t, chain.AddBlock(childBlock(chain, genesis)))
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+
+	// a side branch block is written through the journal as well
+	side := childBlock(chain, genesis)
+	bs.fail = true
+	assert.ErrorIs(t, chain.AddBlock(side), ErrStoreInconsistent)
+	pending, err := j.Pending()
+	require.Nil(t, err)
+	require.NotNil(t, pending)
+
+	bs.fail = false
+	_, err = NewChain(testGenesis(), bs, ts, us, j)
+	require.Nil(t, err)
+	_, err = bs.Get(hex.EncodeToString(types.HashBlock(side)))
+	assert.Nil(t, err)
+}
+
+func TestChainRecoverInterruptedCommit(t *testing.T) {
+	var (
+		bs      = NewMemoryBlockStore()
+		ts      = NewMemoryTxStore()
+		us      = &failingUTXOStore{MemoryUTXOStore: NewMemoryUTXOStore(), failPuts: 1}
+		j       = NewMemoryJournal()
+		prvKey  = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		address = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	)
+
+	// the genesis block is the only write that goes through
+	chain, err := NewChain(testGenesis(), bs, ts, us, j)
+	require.Nil(t, err)
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 400, Address: address},
+		&proto.TxOutput{Amount: 600, Address: prvKey.PublicKey().Address().Bytes()},
+	)
+	err = addTxBlock(t, chain, tx)
+	assert.True(t, errors.Is(err, ErrStoreInconsistent))
+	assert.Equal(t, 0, chain.Height())
+	assert.True(t, errors.Is(chain.AddBlock(randomBlock(t, chain)), ErrStoreInconsistent))
+
+	// the stores are half written, the block is stored but the best block
+	// still points at genesis
+	best, err := us.BestBlock()
+	require.Nil(t, err)
+	assert.Equal(t, chain.Tip().Hash, best)
+
+	us.failPuts = -1
+	chain, err = NewChain(testGenesis(), bs, ts, us, j)
+	require.Nil(t, err)
+	assert.Equal(t, 1, chain.Height())
+
+	pending, err := j.Pending()
+	require.Nil(t, err)
+	assert.Nil(t, pending)
+
+	txHash := hex.EncodeToString(types.HashTransaction(tx))
+	for i := range tx.Outputs {
+		_, err := chain.utxoStore.Get(utxoKey(txHash, i))
+		assert.Nil(t, err)
+	}
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(genesisTx(t, chain))), 0))
+	assert.NotNil(t, err)
+}
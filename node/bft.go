@@ -0,0 +1,367 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"sync"
+	"time"
+)
+
+// bftStep is a step of a round of the BFT protocol
+type bftStep int
+
+const (
+	// stepNewHeight waits for the block interval after the last commit
+	stepNewHeight bftStep = iota
+	stepPropose
+	stepPrevote
+	stepPrecommit
+)
+
+// bftState runs the BFT protocol for a validator node. It is driven by the
+// proposals and votes of the validators and by tick, which moves on once the
+// current step timed out. Messages for the other validators are passed to
+// send.
+//
+// A validator that saw more than two thirds prevote a block locks on it and
+// prevotes and proposes only that block in later rounds, until more than two
+// thirds prevote for nil. So two blocks can only be committed at the same
+// height if more than a third of the validators sign conflicting votes.
+type bftState struct {
+	lock   sync.Mutex
+	node   *Node
+	engine *consensus.BFT
+	send   func(msg any)
+
+	height     int
+	round      int
+	step       bftStep
+	deadline   time.Time
+	validators [][]byte // the validator set of the current height
+
+	proposals   map[int]*proto.Block    // the valid proposal of every round
+	blocks      map[string]*proto.Block // the proposed blocks by hash
+	prevotes    map[int]*consensus.VoteSet
+	precommits  map[int]*consensus.VoteSet
+	lockedBlock *proto.Block
+	// proposed is the block we proposed at this height, we never sign a
+	// second block at a height
+	proposed *proto.Block
+
+	// future holds messages for the next height that arrived early
+	future []any
+}
+
+func newBFTState(node *Node, engine *consensus.BFT, send func(msg any)) *bftState {
+	return &bftState{
+		node:   node,
+		engine: engine,
+		send:   send,
+	}
+}
+
+// tick starts the next height once a block was committed at the current one
+// and ends the current step if it timed out.
+func (s *bftState) tick(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.node.Chain.Committed().Height >= s.height {
+		s.startHeight(now)
+	}
+	if now.Before(s.deadline) {
+		return
+	}
+
+	switch s.step {
+	case stepNewHeight:
+		s.startRound(0, now)
+	case stepPropose:
+		s.prevote(now)
+	case stepPrevote:
+		s.precommit(nil, now)
+	case stepPrecommit:
+		s.startRound(s.round+1, now)
+	}
+}
+
+// handleProposal verifies the proposal and records it if its block is valid
+// on top of our chain. It returns true if the proposal is new.
+func (s *bftState) handleProposal(proposal *proto.Proposal, now time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addProposal(proposal, now)
+}
+
+// handleVote verifies the vote and adds it to the votes of its round. It
+// returns true if the vote is new.
+func (s *bftState) handleVote(vote *proto.Vote, now time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addVote(vote, now)
+}
+
+func (s *bftState) addProposal(proposal *proto.Proposal, now time.Time) (bool, error) {
+	if int(proposal.Height) != s.height {
+		s.keepForNextHeight(int(proposal.Height), proposal)
+		return false, nil
+	}
+	if _, ok := s.proposals[int(proposal.Round)]; ok {
+		return false, nil
+	}
+
+	if err := consensus.VerifyProposal(s.validators, proposal); err != nil {
+		return false, err
+	}
+	s.node.checkDoubleSign(proposal.Block)
+	if err := s.node.Chain.ValidateBlock(proposal.Block); err != nil {
+		return false, err
+	}
+
+	s.proposals[int(proposal.Round)] = proposal.Block
+	s.blocks[hex.EncodeToString(types.HashBlock(proposal.Block))] = proposal.Block
+	s.advance(now)
+	return true, nil
+}
+
+func (s *bftState) addVote(vote *proto.Vote, now time.Time) (bool, error) {
+	if int(vote.Height) != s.height {
+		s.keepForNextHeight(int(vote.Height), vote)
+		return false, nil
+	}
+
+	var sets map[int]*consensus.VoteSet
+	switch vote.Type {
+	case proto.SignedMsgType_PREVOTE:
+		sets = s.prevotes
+	case proto.SignedMsgType_PRECOMMIT:
+		sets = s.precommits
+	default:
+		return false, fmt.Errorf("%w: unexpected %s", consensus.ErrInvalidVote, vote.Type)
+	}
+
+	round := int(vote.Round)
+	if sets[round] == nil {
+		sets[round] = consensus.NewVoteSet(s.validators, s.height, round, vote.Type)
+	}
+	added, err := sets[round].Add(vote)
+	if err != nil || !added {
+		return false, err
+	}
+
+	s.advance(now)
+	return true, nil
+}
+
+// keepForNextHeight keeps a message of the next height until we get there
+func (s *bftState) keepForNextHeight(height int, msg any) {
+	if height == s.height+1 {
+		s.future = append(s.future, msg)
+	}
+}
+
+// startHeight starts the height following the last committed block
+func (s *bftState) startHeight(now time.Time) {
+	tip := s.node.Chain.Committed()
+	s.height = tip.Height + 1
+	s.round = 0
+	s.step = stepNewHeight
+	s.deadline = time.Unix(0, tip.Header.Timestamp).Add(s.engine.Interval())
+	s.validators = s.node.Chain.Validators(tip.Header)
+	s.proposals = make(map[int]*proto.Block)
+	s.blocks = make(map[string]*proto.Block)
+	s.prevotes = make(map[int]*consensus.VoteSet)
+	s.precommits = make(map[int]*consensus.VoteSet)
+	s.lockedBlock = nil
+	s.proposed = nil
+
+	future := s.future
+	s.future = nil
+	for _, msg := range future {
+		switch msg := msg.(type) {
+		case *proto.Proposal:
+			s.addProposal(msg, now)
+		case *proto.Vote:
+			s.addVote(msg, now)
+		}
+	}
+}
+
+// startRound starts the given round of the current height, proposing a block
+// if it is our turn.
+func (s *bftState) startRound(round int, now time.Time) {
+	s.round = round
+	s.step = stepPropose
+	s.deadline = now.Add(s.engine.Timeout(round))
+
+	if bytes.Equal(consensus.Proposer(s.validators, s.height, round), s.node.PrivateKey.PublicKey().Bytes()) {
+		s.propose(now)
+	}
+	s.advance(now)
+}
+
+// propose proposes the block we are locked on, else the block we proposed in
+// an earlier round, else a new block from the mempool
+func (s *bftState) propose(now time.Time) {
+	block := s.lockedBlock
+	if block == nil {
+		block = s.proposed
+	}
+	if block == nil {
+		// the transactions stay in the mempool until the block is committed
+		txx := s.node.mempool.Clear()
+		built, _, err := s.node.Chain.BuildBlock(s.node.PrivateKey.PublicKey(), txx, s.node.evidence.Pending(), now)
+		for _, tx := range txx {
+			s.node.mempool.Add(tx)
+		}
+		if err != nil {
+			s.node.logger.Errorf("Error building proposal - %s", err)
+			return
+		}
+		if err := s.engine.Seal(s.node.Chain, built, s.node.PrivateKey, nil); err != nil {
+			s.node.logger.Errorf("Error sealing proposal - %s", err)
+			return
+		}
+		block = built
+		s.proposed = built
+	}
+
+	proposal := &proto.Proposal{
+		Height: int32(s.height),
+		Round:  int32(s.round),
+		Block:  block,
+	}
+	consensus.SignProposal(s.node.PrivateKey, proposal)
+	s.send(proposal)
+	if _, err := s.addProposal(proposal, now); err != nil {
+		s.node.logger.Errorf("Error adding own proposal - %s", err)
+	}
+}
+
+// prevote prevotes the block we are locked on, else the proposal of the
+// round, else nil.
+func (s *bftState) prevote(now time.Time) {
+	s.step = stepPrevote
+	s.deadline = now.Add(s.engine.Timeout(s.round))
+
+	var hash []byte
+	if s.lockedBlock != nil {
+		hash = types.HashBlock(s.lockedBlock)
+	} else if block, ok := s.proposals[s.round]; ok {
+		hash = types.HashBlock(block)
+	}
+	s.vote(proto.SignedMsgType_PREVOTE, hash, now)
+}
+
+// precommit precommits the block with the given hash, or nil
+func (s *bftState) precommit(hash []byte, now time.Time) {
+	s.step = stepPrecommit
+	s.deadline = now.Add(s.engine.Timeout(s.round))
+	s.vote(proto.SignedMsgType_PRECOMMIT, hash, now)
+}
+
+// vote signs and sends a vote if we are in the validator set of the height
+func (s *bftState) vote(typ proto.SignedMsgType, hash []byte, now time.Time) {
+	if !consensus.IsValidator(s.validators, s.node.PrivateKey.PublicKey().Bytes()) {
+		return
+	}
+
+	vote := &proto.Vote{
+		Type:      typ,
+		Height:    int32(s.height),
+		Round:     int32(s.round),
+		BlockHash: hash,
+	}
+	consensus.SignVote(s.node.PrivateKey, vote)
+	s.send(vote)
+	if _, err := s.addVote(vote, now); err != nil {
+		s.node.logger.Errorf("Error adding own vote - %s", err)
+	}
+}
+
+// advance moves the protocol on as far as the collected messages allow
+func (s *bftState) advance(now time.Time) {
+	// a quorum of precommits in any round commits the block
+	for _, set := range s.precommits {
+		hash, ok := set.Majority()
+		if !ok || len(hash) == 0 {
+			continue
+		}
+		if block, ok := s.blocks[hex.EncodeToString(hash)]; ok {
+			s.commit(block, set.Certificate(hash), now)
+			return
+		}
+	}
+
+	// the other validators are in a later round already
+	for round := range s.prevotes {
+		if round > s.round && s.prevotes[round].HasQuorum() {
+			s.startRound(round, now)
+			return
+		}
+	}
+	for round := range s.precommits {
+		if round > s.round && s.precommits[round].HasQuorum() {
+			s.startRound(round, now)
+			return
+		}
+	}
+
+	switch s.step {
+	case stepPropose:
+		if _, ok := s.proposals[s.round]; ok {
+			s.prevote(now)
+		}
+	case stepPrevote:
+		set := s.prevotes[s.round]
+		if set == nil {
+			return
+		}
+		hash, ok := set.Majority()
+		if !ok {
+			return
+		}
+		if len(hash) == 0 {
+			s.lockedBlock = nil
+			s.precommit(nil, now)
+			return
+		}
+		block, ok := s.blocks[hex.EncodeToString(hash)]
+		if !ok {
+			s.precommit(nil, now)
+			return
+		}
+		s.lockedBlock = block
+		s.precommit(hash, now)
+	case stepPrecommit:
+		if set := s.precommits[s.round]; set != nil {
+			if hash, ok := set.Majority(); ok && len(hash) == 0 {
+				s.startRound(s.round+1, now)
+			}
+		}
+	}
+}
+
+// commit adds the block with its commit certificate to the chain, relays
+// both and starts the next height.
+func (s *bftState) commit(block *proto.Block, cert *proto.CommitCertificate, now time.Time) {
+	if err := s.node.Chain.AddBlock(block); err != nil && !errors.Is(err, ErrKnownBlock) {
+		s.node.logger.Errorf("Error adding committed block - %s", err)
+		return
+	}
+	if err := s.node.Chain.CommitBlock(cert); err != nil {
+		s.node.logger.Errorf("Error committing block - %s", err)
+		return
+	}
+	s.node.logger.Debugw("committed block", "height", s.height, "round", cert.Round, "precommits", len(cert.Precommits))
+
+	s.node.seenBlocks.Put(hex.EncodeToString(types.HashBlock(block)), true)
+	s.send(block)
+	s.send(cert)
+	s.startHeight(now)
+}
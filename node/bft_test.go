@@ -0,0 +1,317 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// bftGenesis returns the genesis of a BFT network run by the given validators
+func bftGenesis(keys ...*crypto.PrivateKey) *Genesis {
+	genesis := testGenesis()
+	genesis.Consensus.Engine = consensus.EngineBFT
+	for _, key := range keys {
+		genesis.Validators = append(genesis.Validators, key.PublicKey().Bytes())
+	}
+	return genesis
+}
+
+func bftKeys(count int) []*crypto.PrivateKey {
+	keys := make([]*crypto.PrivateKey, count)
+	for i := range keys {
+		keys[i] = crypto.GeneratePrivateKey()
+	}
+	return keys
+}
+
+// commitCert returns a certificate for the block holding precommits of the keys
+func commitCert(block *proto.Block, round int, keys ...*crypto.PrivateKey) *proto.CommitCertificate {
+	cert := &proto.CommitCertificate{
+		Height:    block.Header.Height,
+		Round:     int32(round),
+		BlockHash: types.HashBlock(block),
+	}
+	for _, key := range keys {
+		vote := &proto.Vote{
+			Type:      proto.SignedMsgType_PRECOMMIT,
+			Height:    cert.Height,
+			Round:     cert.Round,
+			BlockHash: cert.BlockHash,
+		}
+		consensus.SignVote(key, vote)
+		cert.Precommits = append(cert.Precommits, vote)
+	}
+	return cert
+}
+
+func hashOf(block *proto.Block) string {
+	return hex.EncodeToString(types.HashBlock(block))
+}
+
+func TestChainCommitBlock(t *testing.T) {
+	keys := bftKeys(4)
+	chain, err := NewChain(bftGenesis(keys...), NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	assert.Equal(t, 0, chain.Committed().Height)
+
+	// only validators sign blocks
+	assert.ErrorIs(t, chain.AddBlock(validatorBlock(chain, genesis, crypto.GeneratePrivateKey())), consensus.ErrWrongProposer)
+
+	var (
+		a = validatorBlock(chain, genesis, keys[0])
+		b = validatorBlock(chain, genesis, keys[1])
+	)
+	// blocks only join the main chain with a certificate
+	require.Nil(t, chain.AddBlock(a))
+	require.Nil(t, chain.AddBlock(b))
+	assert.Equal(t, 0, chain.Height())
+
+	// two of four precommits are not enough
+	assert.ErrorIs(t, chain.CommitBlock(commitCert(b, 0, keys[0], keys[1])), consensus.ErrInvalidCommit)
+	assert.ErrorIs(t, chain.CommitBlock(commitCert(b, 0, keys[0], keys[1], crypto.GeneratePrivateKey())), consensus.ErrInvalidCommit)
+
+	// committing a block connects it
+	require.Nil(t, chain.CommitBlock(commitCert(b, 0, keys[0], keys[1], keys[2])))
+	assert.Equal(t, hashOf(b), chain.Tip().Hash)
+	assert.Equal(t, hashOf(b), chain.Committed().Hash)
+	cert, err := chain.GetCommit(types.HashBlock(b))
+	require.Nil(t, err)
+	assert.Len(t, cert.Precommits, 3)
+
+	// nothing can replace a committed block
+	assert.ErrorIs(t, chain.AddBlock(validatorBlock(chain, genesis, keys[2])), ErrConflictsWithCommit)
+	assert.ErrorIs(t, chain.AddBlock(validatorBlock(chain, a, keys[2])), ErrConflictsWithCommit)
+	assert.ErrorIs(t, chain.CommitBlock(commitCert(a, 0, keys...)), ErrConflictsWithCommit)
+	require.Nil(t, chain.CommitBlock(commitCert(b, 1, keys...)))
+
+	// committing a block commits the blocks it builds on
+	var (
+		c = validatorBlock(chain, b, keys[2])
+		d = validatorBlock(chain, b, keys[3])
+	)
+	require.Nil(t, chain.AddBlock(c))
+	require.Nil(t, chain.AddBlock(d))
+	e := validatorBlock(chain, d, keys[0])
+	require.Nil(t, chain.AddBlock(e))
+	assert.Equal(t, 1, chain.Height())
+	require.Nil(t, chain.CommitBlock(commitCert(e, 0, keys...)))
+	assert.Equal(t, hashOf(e), chain.Tip().Hash)
+	assert.Equal(t, 3, chain.Committed().Height)
+	assert.ErrorIs(t, chain.CommitBlock(commitCert(c, 0, keys...)), ErrConflictsWithCommit)
+
+	assert.ErrorIs(t, newTestChain(t).CommitBlock(commitCert(a, 0, keys...)), ErrNoFinality)
+}
+
+func TestChainReloadCommitted(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		keys    = bftKeys(4)
+		genesis = bftGenesis(keys...)
+	)
+	open := func() (*Chain, *FileBlockStore) {
+		bs, err := NewFileBlockStore(filepath.Join(dir, "blocks"))
+		require.Nil(t, err)
+		us, err := NewFileUTXOStore(dir)
+		require.Nil(t, err)
+		j, err := NewFileJournal(dir)
+		require.Nil(t, err)
+		chain, err := NewChain(genesis, bs, NewMemoryTxStore(), us, j)
+		require.Nil(t, err)
+		t.Cleanup(func() { us.Close() })
+		return chain, bs
+	}
+
+	chain, bs := open()
+	tip, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		tip = validatorBlock(chain, tip, keys[i])
+		require.Nil(t, chain.AddBlock(tip))
+		if i < 2 {
+			require.Nil(t, chain.CommitBlock(commitCert(tip, 0, keys...)))
+		}
+	}
+	require.Nil(t, bs.Close())
+
+	assert.Equal(t, 2, chain.Height())
+
+	chain, bs = open()
+	defer bs.Close()
+	assert.Equal(t, 2, chain.Height())
+	assert.Equal(t, 2, chain.Committed().Height)
+}
+
+// bftNetwork connects the BFT states of validator nodes directly. Messages
+// are delivered in the order they were sent.
+type bftNetwork struct {
+	t       *testing.T
+	nodes   []*Node
+	offline map[int]bool
+	queue   []bftMessage
+}
+
+type bftMessage struct {
+	from int
+	msg  any
+}
+
+func newBFTNetwork(t *testing.T, keys []*crypto.PrivateKey) *bftNetwork {
+	net := &bftNetwork{t: t, offline: make(map[int]bool)}
+	genesis := bftGenesis(keys...)
+	for i, key := range keys {
+		chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+		require.Nil(t, err)
+
+		n := New(ServerConfig{PrivateKey: key, Chain: chain})
+		require.NotNil(t, n.bft)
+		from := i
+		n.bft.send = func(msg any) {
+			net.queue = append(net.queue, bftMessage{from: from, msg: msg})
+		}
+		net.nodes = append(net.nodes, n)
+	}
+	return net
+}
+
+// tick ticks the online nodes and delivers the messages they send
+func (net *bftNetwork) tick(now time.Time) {
+	for i, n := range net.nodes {
+		if !net.offline[i] {
+			n.bft.tick(now)
+		}
+	}
+	net.deliver(now)
+}
+
+func (net *bftNetwork) deliver(now time.Time) {
+	for len(net.queue) > 0 {
+		m := net.queue[0]
+		net.queue = net.queue[1:]
+		for i, n := range net.nodes {
+			if i == m.from || net.offline[i] {
+				continue
+			}
+
+			var err error
+			switch msg := m.msg.(type) {
+			case *proto.Proposal:
+				_, err = n.bft.handleProposal(msg, now)
+			case *proto.Vote:
+				_, err = n.bft.handleVote(msg, now)
+			case *proto.Block:
+				if err = n.Chain.AddBlock(msg); errors.Is(err, ErrKnownBlock) {
+					err = nil
+				}
+			case *proto.CommitCertificate:
+				err = n.Chain.CommitBlock(msg)
+			}
+			require.Nil(net.t, err)
+		}
+	}
+}
+
+func TestBFTCommit(t *testing.T) {
+	var (
+		net = newBFTNetwork(t, bftKeys(4))
+		now = time.Now()
+	)
+
+	net.tick(now)
+	for _, n := range net.nodes {
+		assert.Equal(t, 1, n.Chain.Height())
+		assert.Equal(t, 1, n.Chain.Committed().Height)
+		assert.Equal(t, net.nodes[0].Chain.Tip().Hash, n.Chain.Tip().Hash)
+	}
+
+	// height 1 is proposed by the second validator in round 0
+	block, err := net.nodes[0].Chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	assert.Equal(t, net.nodes[1].PrivateKey.PublicKey().Bytes(), block.PublicKey)
+	cert, err := net.nodes[0].Chain.GetCommit(types.HashBlock(block))
+	require.Nil(t, err)
+	assert.Equal(t, int32(0), cert.Round)
+	assert.GreaterOrEqual(t, len(cert.Precommits), 3)
+
+	// the next height waits for the block interval
+	net.tick(now)
+	assert.Equal(t, 1, net.nodes[0].Chain.Height())
+	net.tick(now.Add(net.nodes[0].Chain.Params().BlockInterval()))
+	for _, n := range net.nodes {
+		assert.Equal(t, 2, n.Chain.Committed().Height)
+	}
+}
+
+func TestBFTRoundTimeout(t *testing.T) {
+	var (
+		net     = newBFTNetwork(t, bftKeys(4))
+		engine  = net.nodes[0].Chain.Engine().(*consensus.BFT)
+		now     = time.Now()
+		stalled = net.nodes[1]
+	)
+
+	// the proposer of round 0 is offline
+	net.offline[1] = true
+	net.tick(now)
+	assert.Equal(t, 0, net.nodes[0].Chain.Height())
+
+	// the validators prevote nil after the timeout and move to round 1
+	net.tick(now.Add(engine.Timeout(0)))
+	for i, n := range net.nodes {
+		if i == 1 {
+			continue
+		}
+		assert.Equal(t, 1, n.Chain.Committed().Height)
+	}
+
+	block, err := net.nodes[0].Chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	assert.Equal(t, net.nodes[2].PrivateKey.PublicKey().Bytes(), block.PublicKey)
+	cert, err := net.nodes[0].Chain.GetCommit(types.HashBlock(block))
+	require.Nil(t, err)
+	assert.Equal(t, int32(1), cert.Round)
+
+	// the offline validator catches up from the block and its certificate
+	assert.Equal(t, 0, stalled.Chain.Height())
+	require.Nil(t, stalled.Chain.AddBlock(block))
+	require.Nil(t, stalled.Chain.CommitBlock(cert))
+	assert.Equal(t, 1, stalled.Chain.Committed().Height)
+}
+
+func TestBFTUncertifiedBlock(t *testing.T) {
+	var (
+		net = newBFTNetwork(t, bftKeys(4))
+		now = time.Now()
+		n   = net.nodes[0]
+	)
+	genesis, err := n.Chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	// a validator gossiping a block on its own does not move the chain on
+	block := validatorBlock(n.Chain, genesis, net.nodes[2].PrivateKey)
+	_, err = n.HandleBlock(context.Background(), block)
+	require.Nil(t, err)
+	assert.Equal(t, 0, n.Chain.Height())
+	assert.Equal(t, 0, n.Chain.Committed().Height)
+
+	n.bft.tick(now)
+	assert.Equal(t, 1, n.bft.height)
+
+	// the validators still commit height 1 together
+	net.tick(now)
+	for _, n := range net.nodes {
+		assert.Equal(t, 1, n.Chain.Height())
+		assert.Equal(t, 1, n.Chain.Committed().Height)
+	}
+}
@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
 	"github.com/fzft/crypto-prd-blockchain/crypto"
 	"github.com/fzft/crypto-prd-blockchain/proto"
 	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	pb "github.com/golang/protobuf/proto"
+	"math"
+	"sync"
+	"time"
 )
 
-const godSeed = "b3853c01222f908d08a87d0dd8ce7b0d1324d9967b5da9342ee185d5c1ee295e"
-
 type HeaderList struct {
 	headers []*proto.Header
 }
@@ -32,6 +36,13 @@ func (l *HeaderList) AddHeader(header *proto.Header) {
 	l.headers = append(l.headers, header)
 }
 
+// RemoveLast removes the last header of the list
+func (l *HeaderList) RemoveLast() *proto.Header {
+	header := l.headers[l.Height()]
+	l.headers = l.headers[:l.Height()]
+	return header
+}
+
 // Len returns the length of the list
 func (l *HeaderList) Len() int {
 	return len(l.headers)
@@ -42,43 +53,464 @@ func (l *HeaderList) Height() int {
 	return l.Len() - 1
 }
 
-type UTXO struct {
-	Hash     string
-	OutIndex int
-	Amount   int64
-	Spent    bool
+// VerifyTxProof checks that the transaction of the proof is part of the block
+// at the proof's height in the list. Light clients keep nothing but the
+// headers, this is all they need to trust a transaction.
+func (l *HeaderList) VerifyTxProof(proof *proto.TxProof) error {
+	height := int(proof.Height)
+	if height < 0 || height > l.Height() {
+		return fmt.Errorf("%w: no header at height %d", ErrInvalidProof, height)
+	}
+	if !types.VerifyTxProof(l.Get(height), proof) {
+		return fmt.Errorf("%w: transaction is not in block %x", ErrInvalidProof, proof.BlockHash)
+	}
+	return nil
+}
+
+// ChainEventType is the type of a ChainEvent
+type ChainEventType int
+
+const (
+	BlockConnected ChainEventType = iota
+	BlockDisconnected
+)
+
+// ChainEvent is emitted whenever a block is connected to or disconnected from
+// the main chain.
+type ChainEvent struct {
+	Type  ChainEventType
+	Block *proto.Block
 }
 
 type Chain struct {
+	lock sync.RWMutex
+
+	genesis     *Genesis
+	genesisHash string
+	engine      consensus.Engine
+
 	blockStore BlockStore
 	txStore    TxStore
 	headers    *HeaderList
 	utxoStore  UTXOSore
+	journal    Journal
+
+	index      *blockIndex
+	tip        *BlockNode
+	forkChoice ForkChoice
+	handlers   []func(ChainEvent)
+
+	// committed is the last block with a commit certificate. It and its
+	// ancestors are final, the chain never reorgs below it.
+	committed *BlockNode
+
+	// stake is the bonded stake of every validator on the main chain
+	stake map[string]int64
+	// validatorSets holds the validator set elected after every epoch
+	// boundary block, by block hash
+	validatorSets map[string][][]byte
+	// jailed holds the validators caught signing two blocks at the same
+	// height on the main chain, with the height of the block that jailed them
+	jailed map[string]int
+
+	// state is the sparse merkle tree of the utxo set at the tip, the state
+	// root of the tip header is its root
+	state *util.SparseMerkleTree
+
+	// failed is set when a commit could not be applied to the stores
+	failed error
+}
+
+// NewChain creates a chain of the network described by the genesis on top of
+// the given stores. Writes to the stores go through the journal, a block that
+// was only partly written when the node stopped is written again first. If
+// the stores already hold a chain, its header list and block index are
+// reloaded, otherwise the chain starts with the genesis block.
+func NewChain(genesis *Genesis, bs BlockStore, ts TxStore, us UTXOSore, j Journal) (*Chain, error) {
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+
+	engine, err := genesis.Engine()
+	if err != nil {
+		return nil, err
+	}
+
+	// proof-of-work chains follow the most work, not the most blocks
+	var forkChoice ForkChoice = LongestChain{}
+	if genesis.Consensus.Engine == consensus.EnginePoW {
+		forkChoice = HeaviestChain{}
+	}
+
+	chain := &Chain{
+		genesis:       genesis,
+		engine:        engine,
+		genesisHash:   hex.EncodeToString(genesis.Hash()),
+		blockStore:    bs,
+		headers:       NewHeaderList(),
+		txStore:       ts,
+		utxoStore:     us,
+		journal:       j,
+		index:         newBlockIndex(),
+		forkChoice:    forkChoice,
+		stake:         make(map[string]int64),
+		validatorSets: make(map[string][][]byte),
+		jailed:        make(map[string]int),
+		state:         util.NewSparseMerkleTree(),
+	}
+
+	if err := chain.recover(); err != nil {
+		return nil, err
+	}
+
+	best, err := us.BestBlock()
+	if err != nil {
+		return nil, err
+	}
+	if best == "" {
+		if err := chain.addBlock(genesis.Block()); err != nil {
+			return nil, err
+		}
+		chain.committed = chain.tip
+		return chain, nil
+	}
+
+	if err := chain.load(best); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// recover applies the batch left in the journal by an interrupted commit
+func (c *Chain) recover() error {
+	batch, err := c.journal.Pending()
+	if err != nil || batch == nil {
+		return err
+	}
+
+	if err := batch.apply(c.blockStore, c.txStore, c.utxoStore); err != nil {
+		return fmt.Errorf("recovering interrupted commit: %w", err)
+	}
+	return c.journal.Commit()
+}
+
+// commit records the batch in the journal and applies it to the stores. If
+// applying fails, the stores are left half written until the batch is
+// applied again by recover, so the chain refuses further writes.
+func (c *Chain) commit(batch *StoreBatch) error {
+	if err := c.journal.Begin(batch); err != nil {
+		return err
+	}
+	if err := batch.apply(c.blockStore, c.txStore, c.utxoStore); err != nil {
+		c.failed = fmt.Errorf("%w: %s", ErrStoreInconsistent, err)
+		return c.failed
+	}
+	return c.journal.Commit()
+}
+
+// load rebuilds the header list and the block index from the stored main
+// chain ending in the block with the given hash. The state tree is rebuilt
+// from the leaves stored with the utxo set.
+func (c *Chain) load(tip string) error {
+	var blocks []*proto.Block
+	for hash := tip; ; {
+		block, err := c.blockStore.Get(hash)
+		if err != nil {
+			return fmt.Errorf("loading chain: %w", err)
+		}
+		blocks = append(blocks, block)
+
+		if hash == c.genesisHash {
+			break
+		}
+		if block.Header.Height == 0 {
+			return fmt.Errorf("%w: stored chain does not start at our genesis block", ErrGenesisMismatch)
+		}
+		hash = hex.EncodeToString(block.Header.PrevHash)
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		c.headers.AddHeader(blocks[i].Header)
+		c.tip = c.index.Add(blocks[i])
+
+		undo, err := c.blockStore.GetUndo(c.tip.Hash)
+		if err != nil {
+			return fmt.Errorf("loading chain: %w", err)
+		}
+		c.connectStake(c.tip, blocks[i], undo.Spent)
+	}
+
+	state, err := loadState(c.utxoStore)
+	if err != nil {
+		return fmt.Errorf("loading chain: %w", err)
+	}
+	if header := c.tip.Header; header.Version >= types.StateRootVersion && !bytes.Equal(header.StateRoot, state.Root()) {
+		return fmt.Errorf("loading chain: %w: stored state has root %x, the tip %x", ErrStateRoot, state.Root(), header.StateRoot)
+	}
+	c.state = state
+
+	// the genesis block is final even without a certificate
+	c.committed = c.tip
+	for c.committed.Height > 0 {
+		if _, err := c.blockStore.GetCommit(c.committed.Hash); err == nil {
+			break
+		}
+		c.committed = c.committed.Parent
+	}
+	return nil
+}
+
+// GenesisHash returns the hash of the genesis block
+func (c *Chain) GenesisHash() []byte {
+	hash, _ := hex.DecodeString(c.genesisHash)
+	return hash
+}
+
+// Params returns the consensus parameters of the network
+func (c *Chain) Params() types.ConsensusParams {
+	return c.genesis.Consensus
+}
+
+// HRP returns the human readable part of the addresses of the network
+func (c *Chain) HRP() string {
+	return c.genesis.HRP()
+}
+
+// GetHeader returns the header of the known block with the given hash
+func (c *Chain) GetHeader(hash []byte) *proto.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return chainReader{c}.GetHeader(hash)
+}
+
+// chainReader gives the consensus engine access to the chain while the chain
+// is locked.
+type chainReader struct {
+	c *Chain
+}
+
+func (r chainReader) Params() types.ConsensusParams {
+	return r.c.Params()
+}
+
+func (r chainReader) GetHeader(hash []byte) *proto.Header {
+	node, ok := r.c.index.Get(hex.EncodeToString(hash))
+	if !ok {
+		return nil
+	}
+	return node.Header
+}
+
+func (r chainReader) Validators(parent *proto.Header) [][]byte {
+	return r.c.validators(parent)
+}
+
+// Engine returns the consensus engine of the chain
+func (c *Chain) Engine() consensus.Engine {
+	return c.engine
+}
+
+// Validators returns the validator set of the block following parent
+func (c *Chain) Validators(parent *proto.Header) [][]byte {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validators(parent)
+}
+
+// Stake returns the stake bonded to the validator on the main chain
+func (c *Chain) Stake(validator []byte) int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.stake[hex.EncodeToString(validator)]
+}
+
+// IsValidator returns true if the public key may produce the block following
+// the tip
+func (c *Chain) IsValidator(pubKey []byte) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.engine.Authorized(chainReader{c}, c.tip.Header, pubKey)
+}
+
+// CanPropose returns true if the key may produce the next block at the given time
+func (c *Chain) CanPropose(pubKey []byte, now time.Time) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.engine.Prepare(chainReader{c}, c.tip.Header, &proto.Header{}, pubKey, now) == nil
+}
+
+// SetForkChoice sets the rule used to pick the best chain
+func (c *Chain) SetForkChoice(fc ForkChoice) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.forkChoice = fc
+}
+
+// Subscribe registers a handler that is called for every ChainEvent. Handlers
+// run while the chain is locked and must not call back into the chain.
+func (c *Chain) Subscribe(handler func(ChainEvent)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handlers = append(c.handlers, handler)
 }
 
-func NewChain(bs BlockStore, ts TxStore) *Chain {
-	chain := &Chain{blockStore: bs, headers: NewHeaderList(), txStore: ts, utxoStore: NewMemoryUTXOStore()}
-	chain.addBlock(createGenesisBlock())
-	return chain
+func (c *Chain) emit(event ChainEvent) {
+	for _, handler := range c.handlers {
+		handler(event)
+	}
 }
 
 // Height returns the height of the chain
 func (c *Chain) Height() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.headers.Height()
 }
 
-// AddBlock adds a block to the chain
+// Tip returns the block node of the chain tip
+func (c *Chain) Tip() *BlockNode {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tip
+}
+
+// Committed returns the block node of the last committed block
+func (c *Chain) Committed() *BlockNode {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.committed
+}
+
+// GetCommit returns the commit certificate of the block with the given hash
+func (c *Chain) GetCommit(hash []byte) (*proto.CommitCertificate, error) {
+	return c.blockStore.GetCommit(hex.EncodeToString(hash))
+}
+
+// CommitBlock records the commit certificate of a known block. The block and
+// its ancestors become final. If the block is on a side branch, the chain
+// switches to that branch first. Certificates for blocks that are already
+// final are ignored.
+func (c *Chain) CommitBlock(cert *proto.CommitCertificate) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.failed != nil {
+		return c.failed
+	}
+
+	finality, ok := c.engine.(consensus.Finality)
+	if !ok {
+		return ErrNoFinality
+	}
+
+	hash := hex.EncodeToString(cert.BlockHash)
+	node, ok := c.index.Get(hash)
+	if !ok {
+		return fmt.Errorf("%w: committed block %s is unknown", ErrOrphanBlock, hash)
+	}
+	if node.Height <= c.committed.Height {
+		if c.committed.Ancestor(node.Height) == node {
+			return nil
+		}
+		return fmt.Errorf("%w: %s is not an ancestor of %s", ErrConflictsWithCommit, hash, c.committed.Hash)
+	}
+	if node.Ancestor(c.committed.Height) != c.committed {
+		return fmt.Errorf("%w: %s does not descend from %s", ErrConflictsWithCommit, hash, c.committed.Hash)
+	}
+	if node.Invalid {
+		return fmt.Errorf("%w: %s is invalid", ErrInvalidBlock, hash)
+	}
+
+	if err := finality.VerifyCommit(chainReader{c}, node.Header, cert); err != nil {
+		return err
+	}
+
+	if !c.isMainChain(node) {
+		if err := c.reorg(node); err != nil {
+			return err
+		}
+	}
+
+	batch := NewStoreBatch()
+	batch.PutCommit(hash, cert)
+	if err := c.commit(batch); err != nil {
+		return err
+	}
+	c.committed = node
+	return nil
+}
+
+// AddBlock adds a block to the block tree. A block extending the tip is
+// connected right away, a block on a side branch is stored and its branch
+// becomes the main chain once the fork choice prefers it. With an engine
+// that has finality every block is stored like a side branch, only
+// CommitBlock connects it. Blocks branching off below the last committed
+// block are refused.
 func (c *Chain) AddBlock(block *proto.Block) error {
-	if err := c.ValidateBlock(block); err != nil {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.failed != nil {
+		return c.failed
+	}
+
+	hash := hex.EncodeToString(types.HashBlock(block))
+	if _, ok := c.index.Get(hash); ok {
+		return fmt.Errorf("%w: %s", ErrKnownBlock, hash)
+	}
+
+	parent, ok := c.index.Get(hex.EncodeToString(block.Header.PrevHash))
+	if !ok {
+		return fmt.Errorf("%w: parent of %s is unknown", ErrOrphanBlock, hash)
+	}
+	if parent.Invalid {
+		return fmt.Errorf("%w: %s descends from an invalid block", ErrInvalidBlock, hash)
+	}
+	if fork := c.findFork(parent); fork.Height < c.committed.Height {
+		return fmt.Errorf("%w: %s forks off the main chain at height %d", ErrConflictsWithCommit, hash, fork.Height)
+	}
+
+	// blocks of an engine with finality only join the main chain once they
+	// are committed, until then they are kept like side branches
+	_, finality := c.engine.(consensus.Finality)
+	if parent == c.tip && !finality {
+		if err := c.validateBlock(block); err != nil {
+			return err
+		}
+		return c.addBlock(block)
+	}
+
+	// the utxo set of a side branch is unknown until the branch is connected,
+	// so only the header and consensus checks can be done here
+	if err := c.checkHeader(parent, block, time.Now()); err != nil {
 		return err
 	}
-	return c.addBlock(block)
+	if err := c.verifyConsensus(parent.Header, block); err != nil {
+		return err
+	}
+	batch := NewStoreBatch()
+	batch.PutBlock(block)
+	if err := c.commit(batch); err != nil {
+		return err
+	}
+
+	node := c.index.Add(block)
+	if !finality && c.forkChoice.Better(node, c.tip) {
+		return c.reorg(node)
+	}
+	return nil
 }
 
 // GetBlockByHeight returns a block by its height
 func (c *Chain) GetBlockByHeight(height int) (*proto.Block, error) {
-	if c.Height() < height {
-		return nil, fmt.Errorf("given height (%d) too high - height (%d)", height, c.Height())
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.getBlockByHeight(height)
+}
+
+func (c *Chain) getBlockByHeight(height int) (*proto.Block, error) {
+	if c.headers.Height() < height {
+		return nil, fmt.Errorf("given height (%d) too high - height (%d)", height, c.headers.Height())
 	}
 
 	header := c.headers.Get(height)
@@ -92,111 +524,672 @@ func (c *Chain) GetBlockByHash(hash []byte) (*proto.Block, error) {
 	return c.blockStore.Get(hashHex)
 }
 
-// ValidateBlock validates a block
-func (c *Chain) ValidateBlock(block *proto.Block) error {
-	// validate the signature of the block
-	if !types.VerifyBlock(block) {
-		return fmt.Errorf("block signature is invalid")
+// HasBlock returns true if the block with the given hash is in the block tree
+func (c *Chain) HasBlock(hash []byte) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.index.Get(hex.EncodeToString(hash))
+	return ok
+}
+
+// Locator returns the hashes of main chain blocks from the tip back to the
+// genesis block, dense near the tip and exponentially sparser further back.
+func (c *Chain) Locator() [][]byte {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var (
+		locator [][]byte
+		step    = 1
+	)
+	for height := c.headers.Height(); ; height -= step {
+		if height < 0 {
+			height = 0
+		}
+		locator = append(locator, types.HashHeader(c.headers.Get(height)))
+		if height == 0 {
+			break
+		}
+		if len(locator) >= 10 {
+			step *= 2
+		}
 	}
+	return locator
+}
+
+// HeadersAfter returns up to limit main chain headers following the first
+// locator hash that is on the main chain. If no locator hash is known, the
+// headers following the genesis block are returned.
+func (c *Chain) HeadersAfter(locator [][]byte, limit int) []*proto.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	start := 0
+	for _, hash := range locator {
+		node, ok := c.index.Get(hex.EncodeToString(hash))
+		if ok && c.isMainChain(node) {
+			start = node.Height
+			break
+		}
+	}
+
+	var headers []*proto.Header
+	for height := start + 1; height <= c.headers.Height() && len(headers) < limit; height++ {
+		headers = append(headers, c.headers.Get(height))
+	}
+	return headers
+}
+
+// ValidateBlock validates a block against the chain tip
+func (c *Chain) ValidateBlock(block *proto.Block) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validateBlock(block)
+}
 
+func (c *Chain) validateBlock(block *proto.Block) error {
 	// validate if the preHash is the actual hash of the current block
-	currentBlock, err := c.GetBlockByHeight(c.Height())
-	if err != nil {
+	if hex.EncodeToString(block.Header.PrevHash) != c.tip.Hash {
+		return fmt.Errorf("block hash does not match previous block hash")
+	}
+
+	if err := c.checkHeader(c.tip, block, time.Now()); err != nil {
 		return err
 	}
-	hash := types.HashBlock(currentBlock)
-	if !bytes.Equal(hash, block.Header.PrevHash) {
-		return fmt.Errorf("block hash does not match previous block hash")
+	if err := c.verifyConsensus(c.tip.Header, block); err != nil {
+		return err
 	}
 
-	for _, tx := range block.Transactions {
-		if err = c.validateTransaction(tx); err != nil {
+	// every block starts with exactly one coinbase, validateTransaction
+	// rejects coinbases anywhere else
+	if len(block.Transactions) == 0 || !types.IsCoinbaseTx(block.Transactions[0]) {
+		return fmt.Errorf("%w: block does not start with a coinbase", ErrInvalidCoinbase)
+	}
+	if err := checkBlockTransactions(block.Transactions); err != nil {
+		return err
+	}
+
+	var (
+		height    = c.tip.Height + 1
+		view      = newUTXOView(c.utxoStore, height)
+		fees      int64
+		offenders = make(map[string]bool, len(block.Evidence))
+	)
+	for i, evidence := range block.Evidence {
+		offender := hex.EncodeToString(evidence.PublicKey)
+		if offenders[offender] {
+			return fmt.Errorf("%w: evidence %d punishes %s twice", ErrInvalidEvidence, i, offender)
+		}
+		offenders[offender] = true
+
+		if err := c.validateEvidence(evidence, height); err != nil {
+			return fmt.Errorf("evidence %d: %w", i, err)
+		}
+	}
+	// the offenders are jailed before the transactions of the block, their
+	// stake can not escape the slashing in the same block
+	jailed := jailedBy(c.jailed, block.Evidence, height)
+	for _, tx := range block.Transactions[1:] {
+		fee, err := c.validateTransaction(view, jailed, tx)
+		if err != nil {
+			return err
+		}
+		if fees, err = addAmount(fees, fee); err != nil {
+			return err
+		}
+		// later transactions may spend the outputs of earlier ones
+		if err := view.ApplyTx(tx); err != nil {
 			return err
 		}
 	}
 
+	if err := c.verifyValidators(block, view.Undo().Spent); err != nil {
+		return err
+	}
+	if err := c.verifyStateRoot(block); err != nil {
+		return err
+	}
+
+	reward, err := addAmount(c.genesis.Consensus.Subsidy(height), fees)
+	if err != nil {
+		return err
+	}
+	return validateCoinbase(block.Transactions[0], height, reward)
+}
+
+// checkBlockTransactions checks that the transactions of a block do not
+// conflict with each other. Every transaction appears once, no output is
+// spent by two transactions and a transaction only spends outputs of the
+// transactions before it, so the block can be applied in order.
+func checkBlockTransactions(txx []*proto.Transaction) error {
+	created := make(map[string]int, len(txx))
+	for i, tx := range txx {
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		if j, ok := created[hash]; ok {
+			return fmt.Errorf("%w: %w: transactions %d and %d are %s", ErrInvalidBlock, ErrDuplicateTx, j, i, hash)
+		}
+		created[hash] = i
+	}
+
+	spent := make(map[string]int)
+	for i, tx := range txx {
+		// the input of a coinbase spends nothing
+		if types.IsCoinbaseTx(tx) {
+			continue
+		}
+		for k, input := range tx.Inputs {
+			prevHash := hex.EncodeToString(input.PrevTxHash)
+			if j, ok := created[prevHash]; ok && j >= i {
+				return fmt.Errorf("%w: %w: input %d of transaction %d spends transaction %d", ErrInvalidBlock, ErrSpendsLaterTx, k, i, j)
+			}
+
+			key := utxoKey(prevHash, int(input.PrevOutIndex))
+			j, ok := spent[key]
+			if ok && j == i {
+				return fmt.Errorf("%w: %w: transaction %d input %d spends %s", ErrInvalidBlock, ErrDuplicateInput, i, k, key)
+			}
+			if ok {
+				return fmt.Errorf("%w: %w: %s is spent by transactions %d and %d", ErrInvalidBlock, ErrDoubleSpend, key, j, i)
+			}
+			spent[key] = i
+		}
+	}
 	return nil
 }
 
-// validateTransaction validates a transaction
-func (c *Chain) validateTransaction(tx *proto.Transaction) error {
-	if !types.VerifyTransaction(tx) {
-		return fmt.Errorf("invalid tx signature")
+// checkHeader checks the rules every block has to follow on top of its
+// parent no matter the consensus engine: a known version not older than the
+// parent's, the next height, a timestamp after the median time of the last
+// blocks and not too far ahead of now, and the size limits.
+func (c *Chain) checkHeader(parent *BlockNode, block *proto.Block, now time.Time) error {
+	var (
+		params = c.genesis.Consensus
+		header = block.Header
+	)
+	if header.Version < 1 || header.Version > types.BlockVersion {
+		return fmt.Errorf("%w: %w: version %d", ErrInvalidBlock, ErrUnknownVersion, header.Version)
+	}
+	// legacy versions are only accepted until a chain moves past them
+	if header.Version < parent.Header.Version {
+		return fmt.Errorf("%w: %w: version %d on top of version %d", ErrInvalidBlock, ErrOldVersion, header.Version, parent.Header.Version)
+	}
+	if int(header.Height) != parent.Height+1 {
+		return fmt.Errorf("%w: %w: height %d on top of height %d", ErrInvalidBlock, ErrBadHeight, header.Height, parent.Height)
+	}
+	if median := parent.MedianTime(params.MedianTimeBlocks); header.Timestamp <= median {
+		return fmt.Errorf("%w: %w: %s is not after %s", ErrInvalidBlock, ErrTimeTooOld,
+			time.Unix(0, header.Timestamp).UTC(), time.Unix(0, median).UTC())
+	}
+	if latest := now.Add(params.MaxFutureDrift()); header.Timestamp > latest.UnixNano() {
+		return fmt.Errorf("%w: %w: %s is after %s", ErrInvalidBlock, ErrTimeTooNew,
+			time.Unix(0, header.Timestamp).UTC(), latest.UTC())
+	}
+	if len(block.Transactions) > params.MaxBlockTxs {
+		return fmt.Errorf("%w: %w: %d transactions", ErrInvalidBlock, ErrTooManyTxs, len(block.Transactions))
 	}
+	if size := pb.Size(block); size > params.MaxBlockBytes {
+		return fmt.Errorf("%w: %w: %d bytes", ErrInvalidBlock, ErrBlockTooLarge, size)
+	}
+	return nil
+}
 
-	//validate if the inputs are valid
-	nInputs := len(tx.Inputs)
-	for i := 0; i < nInputs; i++ {
-		preTxHash := hex.EncodeToString(tx.Inputs[i].PrevTxHash)
-		key := fmt.Sprintf("%s_%d", preTxHash, i)
-		utxo, err := c.utxoStore.Get(key)
+// verifyConsensus lets the engine verify the header and the seal of the block
+// on top of parent.
+func (c *Chain) verifyConsensus(parent *proto.Header, block *proto.Block) error {
+	if err := c.engine.VerifyHeader(chainReader{c}, parent, block.Header, time.Now()); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBlock, err)
+	}
+	if err := c.engine.VerifySeal(chainReader{c}, parent, block); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBlock, err)
+	}
+	return nil
+}
+
+// blockOverhead is the room BuildBlock leaves in a block for the header, the
+// coinbase and the signature
+const blockOverhead = 1024
+
+// BuildBlock assembles an unsealed block of the producer on top of the chain
+// tip at the given time. The block holds as many of the given transactions
+// as fit and are valid and starts with a coinbase paying the subsidy and the
+// fees of the transactions to the producer. Transactions that are not
+// included are returned. The valid evidence is included as well. If the
+// consensus engine does not allow the producer to propose now, the error of
+// the engine is returned.
+func (c *Chain) BuildBlock(producer *crypto.PublicKey, candidates []*proto.Transaction, evidence []*proto.Evidence, now time.Time) (*proto.Block, []*proto.Transaction, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	header := &proto.Header{
+		Version:  types.BlockVersion,
+		PrevHash: types.HashHeader(c.tip.Header),
+	}
+	if err := c.engine.Prepare(chainReader{c}, c.tip.Header, header, producer.Bytes(), now); err != nil {
+		return nil, candidates, err
+	}
+
+	var (
+		height   = c.tip.Height + 1
+		view     = newUTXOView(c.utxoStore, height)
+		fees     int64
+		txx      []*proto.Transaction
+		leftover []*proto.Transaction
+		block    = &proto.Block{Header: header}
+		size     = blockOverhead
+	)
+
+	offenders := make(map[string]bool, len(evidence))
+	for _, e := range evidence {
+		offender := hex.EncodeToString(e.PublicKey)
+		if offenders[offender] || c.validateEvidence(e, height) != nil {
+			continue
+		}
+		evidenceSize := pb.Size(&proto.Block{Evidence: []*proto.Evidence{e}})
+		if size+evidenceSize > c.genesis.Consensus.MaxBlockBytes {
+			continue
+		}
+		offenders[offender] = true
+		block.Evidence = append(block.Evidence, e)
+		size += evidenceSize
+	}
+	jailed := jailedBy(c.jailed, block.Evidence, height)
+
+	for _, tx := range candidates {
+		// one slot is taken by the coinbase
+		if len(txx)+1 >= c.genesis.Consensus.MaxBlockTxs {
+			leftover = append(leftover, tx)
+			continue
+		}
+		txSize := pb.Size(&proto.Block{Transactions: []*proto.Transaction{tx}})
+		if size+txSize > c.genesis.Consensus.MaxBlockBytes {
+			leftover = append(leftover, tx)
+			continue
+		}
+		fee, err := c.validateTransaction(view, jailed, tx)
 		if err != nil {
-			return err
+			leftover = append(leftover, tx)
+			continue
+		}
+		total, err := addAmount(fees, fee)
+		if err != nil {
+			leftover = append(leftover, tx)
+			continue
 		}
-		if utxo.Spent {
-			return fmt.Errorf("output %d of tx %s is already spent", i, preTxHash)
+		if err := view.ApplyTx(tx); err != nil {
+			leftover = append(leftover, tx)
+			continue
 		}
+		fees = total
+		txx = append(txx, tx)
+		size += txSize
+	}
+
+	reward, err := addAmount(c.genesis.Consensus.Subsidy(height), fees)
+	if err != nil {
+		return nil, nil, err
+	}
+	cb := types.GenerateCoinbaseTx(int32(height), producer.Address().Bytes(), reward)
+	if reward == 0 {
+		// nothing left to claim
+		cb.Outputs = nil
+	}
+	block.Transactions = append([]*proto.Transaction{cb}, txx...)
 
-		//TODO(fzft): validate if the amount is correct
+	validators, next := c.blockValidators(block, view.Undo().Spent)
+	header.ValidatorsHash = types.HashValidators(validators)
+	header.NextValidatorsHash = types.HashValidators(next)
+	header.StateRoot = connectState(c.state, block).Root()
+	c.engine.Finalize(chainReader{c}, block)
 
+	return block, leftover, nil
+}
+
+// validateCoinbase validates the coinbase transaction of the block at the
+// given height, which may pay at most reward. A coinbase without outputs
+// gives up the reward.
+func validateCoinbase(tx *proto.Transaction, height int, reward int64) error {
+	if types.CoinbaseHeight(tx) != int32(height) {
+		return fmt.Errorf("%w: coinbase is not for height %d", ErrInvalidCoinbase, height)
+	}
+	if tx.Type != proto.TxType_TRANSFER {
+		return fmt.Errorf("%w: coinbase is a %s transaction", ErrInvalidCoinbase, tx.Type)
 	}
 
+	var total int64
+	for i, output := range tx.Outputs {
+		if output.Amount <= 0 {
+			return fmt.Errorf("%w: output %d has amount %d", ErrInvalidAmount, i, output.Amount)
+		}
+		if len(output.Address) != crypto.AddressLen {
+			return fmt.Errorf("%w: output %d has an invalid address", ErrMalformedTx, i)
+		}
+		if len(output.Validator) > 0 {
+			return fmt.Errorf("%w: output %d bonds stake", ErrInvalidCoinbase, i)
+		}
+
+		var err error
+		if total, err = addAmount(total, output.Amount); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+
+	if total > reward {
+		return fmt.Errorf("%w: coinbase pays %d, reward is %d", ErrInvalidCoinbase, total, reward)
+	}
 	return nil
 }
 
-// addBlock adds a block to the chain
-func (c *Chain) addBlock(block *proto.Block) error {
-	c.headers.AddHeader(block.Header)
+// ValidateTransaction validates a transaction against the utxo set of the chain tip
+func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, err := c.validateTransaction(newUTXOView(c.utxoStore, c.tip.Height+1), c.jailed, tx)
+	return err
+}
 
-	for _, tx := range block.Transactions {
-		if err := c.txStore.Put(tx); err != nil {
-			return err
+// ValidateEvidence validates evidence of double signing against the chain tip
+func (c *Chain) ValidateEvidence(evidence *proto.Evidence) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validateEvidence(evidence, c.tip.Height+1)
+}
+
+// validateTransaction validates a transaction against the given utxo view and
+// jailed validators and returns its fee. Every input must reference an
+// unspent, mature output owned by the spender's key and the outputs may not
+// spend more than the inputs provide. The difference is the fee.
+func (c *Chain) validateTransaction(view *utxoView, jailed map[string]int, tx *proto.Transaction) (int64, error) {
+	if types.IsCoinbaseTx(tx) {
+		return 0, fmt.Errorf("%w: coinbase is not the first transaction of a block", ErrInvalidCoinbase)
+	}
+	if len(tx.Inputs) == 0 {
+		return 0, fmt.Errorf("%w: transaction has no inputs", ErrMalformedTx)
+	}
+	if len(tx.Outputs) == 0 {
+		return 0, fmt.Errorf("%w: transaction has no outputs", ErrMalformedTx)
+	}
+	if _, ok := proto.TxType_name[int32(tx.Type)]; !ok {
+		return 0, fmt.Errorf("%w: unknown transaction type %d", ErrMalformedTx, tx.Type)
+	}
+
+	for i, input := range tx.Inputs {
+		if len(input.PublicKey) != crypto.PubKeyLen {
+			return 0, fmt.Errorf("%w: input %d has an invalid public key", ErrMalformedTx, i)
 		}
+		if len(input.Signature) != crypto.SignatureLen {
+			return 0, fmt.Errorf("%w: input %d has an invalid signature", ErrMalformedTx, i)
+		}
+	}
 
-		hash := hex.EncodeToString(types.HashTransaction(tx))
+	if err := types.VerifyTransaction(tx); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidTxSignature, err)
+	}
+
+	var (
+		totalIn  int64
+		totalOut int64
+		unbonded []byte
+		seen     = make(map[string]bool, len(tx.Inputs))
+	)
 
-		// address_txHash
-		for it, output := range tx.Outputs {
-			utxo := &UTXO{
-				Hash:     hash,
-				OutIndex: it,
-				Amount:   output.Amount,
-				Spent:    false,
+	for i, input := range tx.Inputs {
+		key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+		if seen[key] {
+			return 0, fmt.Errorf("%w: input %d spends %s", ErrDuplicateInput, i, key)
+		}
+		seen[key] = true
+
+		utxo, err := view.Get(key)
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %w", i, err)
+		}
+
+		if utxo.Coinbase && view.height-utxo.Height < c.genesis.Consensus.CoinbaseMaturity {
+			return 0, fmt.Errorf("%w: input %d spends %s created at height %d", ErrImmatureCoinbase, i, key, utxo.Height)
+		}
+		if utxo.Unbonding && view.height-utxo.Height < c.genesis.Consensus.UnbondingPeriod {
+			return 0, fmt.Errorf("%w: input %d spends %s unbonded at height %d", ErrUnbonding, i, key, utxo.Height)
+		}
+
+		// bonded stake is only released by unbond transactions, and only
+		// once it was bonded for a block
+		bonded := utxo.Bonded()
+		if bonded && tx.Type != proto.TxType_UNBOND {
+			return 0, fmt.Errorf("%w: input %d spends stake bonded to %x", ErrBondedOutput, i, utxo.Validator)
+		}
+		if !bonded && tx.Type == proto.TxType_UNBOND {
+			return 0, fmt.Errorf("%w: input %d of an unbond transaction is not bonded", ErrMalformedTx, i)
+		}
+		if bonded && utxo.Height == view.height {
+			return 0, fmt.Errorf("%w: input %d was bonded in the same block", ErrBondedOutput, i)
+		}
+		if tx.Type == proto.TxType_UNBOND {
+			if unbonded != nil && !bytes.Equal(unbonded, utxo.Validator) {
+				return 0, fmt.Errorf("%w: unbond transaction releases stake of several validators", ErrMalformedTx)
 			}
+			unbonded = utxo.Validator
+		}
 
-			if err := c.utxoStore.Put(utxo); err != nil {
-				return err
+		// the slashed part of the stake of a jailed validator is burned
+		amount := utxo.Amount
+		if c.slashed(utxo, jailed) {
+			amount -= c.genesis.Consensus.Slash(amount)
+		}
+
+		owner := crypto.PublicKeyFromBytes(input.PublicKey).Address()
+		if !bytes.Equal(owner.Bytes(), utxo.Address) {
+			return 0, fmt.Errorf("%w: input %d spends %s", ErrWrongOwner, i, key)
+		}
+
+		if totalIn, err = addAmount(totalIn, amount); err != nil {
+			return 0, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+
+	bonds := 0
+	for i, output := range tx.Outputs {
+		if output.Amount <= 0 {
+			return 0, fmt.Errorf("%w: output %d has amount %d", ErrInvalidAmount, i, output.Amount)
+		}
+		if len(output.Address) != crypto.AddressLen {
+			return 0, fmt.Errorf("%w: output %d has an invalid address", ErrMalformedTx, i)
+		}
+		switch {
+		case tx.Type == proto.TxType_UNBOND:
+			// unbonding stake stays slashable for its validator
+			if !bytes.Equal(output.Validator, unbonded) {
+				return 0, fmt.Errorf("%w: output %d is not unbonded from %x", ErrMalformedTx, i, unbonded)
+			}
+		case len(output.Validator) > 0:
+			if tx.Type != proto.TxType_BOND {
+				return 0, fmt.Errorf("%w: output %d of a %s transaction bonds stake", ErrMalformedTx, i, tx.Type)
+			}
+			if len(output.Validator) != crypto.PubKeyLen {
+				return 0, fmt.Errorf("%w: output %d bonds to an invalid validator key", ErrMalformedTx, i)
 			}
+			if _, ok := jailed[hex.EncodeToString(output.Validator)]; ok {
+				return 0, fmt.Errorf("%w: output %d bonds to %x", ErrJailed, i, output.Validator)
+			}
+			bonds++
+		}
+
+		var err error
+		if totalOut, err = addAmount(totalOut, output.Amount); err != nil {
+			return 0, fmt.Errorf("output %d: %w", i, err)
 		}
+	}
 
+	if tx.Type == proto.TxType_BOND && bonds == 0 {
+		return 0, fmt.Errorf("%w: bond transaction bonds nothing", ErrMalformedTx)
+	}
+	if totalOut > totalIn {
+		return 0, fmt.Errorf("%w: outputs (%d) exceed inputs (%d)", ErrInsufficientFunds, totalOut, totalIn)
 	}
 
-	return c.blockStore.Put(block)
+	return totalIn - totalOut, nil
 }
 
-// createGenesisBlock creates a genesis block
-func createGenesisBlock() *proto.Block {
-	// hard coded genesis block
-	prvKey := crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+// addAmount adds two non-negative amounts, failing instead of wrapping around.
+func addAmount(a, b int64) (int64, error) {
+	if b < 0 {
+		return 0, fmt.Errorf("%w: negative amount %d", ErrInvalidAmount, b)
+	}
+	if a > math.MaxInt64-b {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
 
-	block := &proto.Block{
-		Header: &proto.Header{
-			Version: 1,
-		},
+// addBlock adds a block to the chain, spending its inputs and creating its
+// outputs in the utxo set. The consumed utxos are kept as undo data.
+func (c *Chain) addBlock(block *proto.Block) error {
+	view := newUTXOView(c.utxoStore, c.headers.Height()+1)
+	for _, tx := range block.Transactions {
+		if err := view.ApplyTx(tx); err != nil {
+			return err
+		}
 	}
 
-	tx := &proto.Transaction{
-		Version: 1,
-		Inputs:  []*proto.TxInput{},
-		Outputs: []*proto.TxOutput{
-			{
-				Amount:  1000,
-				Address: prvKey.PublicKey().Address().Bytes(),
-			},
-		},
+	hash := hex.EncodeToString(types.HashBlock(block))
+	batch := NewStoreBatch()
+	batch.PutBlock(block)
+	batch.PutUndo(hash, view.Undo())
+	for _, tx := range block.Transactions {
+		batch.PutTx(tx)
+	}
+	view.WriteTo(batch)
+	batch.SetBestBlock(hash)
+
+	if err := c.commit(batch); err != nil {
+		return err
 	}
 
-	block.Transactions = append(block.Transactions, tx)
-	types.SignBlock(prvKey, block)
-	return block
+	// the header list only moves once the stores are written
+	c.headers.AddHeader(block.Header)
+	c.tip = c.index.Add(block)
+	c.connectStake(c.tip, block, view.Undo().Spent)
+	c.state = connectState(c.state, block)
+	c.emit(ChainEvent{Type: BlockConnected, Block: block})
+	return nil
+}
+
+// disconnectTip removes the tip block from the chain and restores the utxo
+// set to the state before the block was added.
+func (c *Chain) disconnectTip() (*proto.Block, error) {
+	if c.headers.Height() == 0 {
+		return nil, fmt.Errorf("cannot disconnect the genesis block")
+	}
+
+	block, err := c.getBlockByHeight(c.headers.Height())
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hex.EncodeToString(types.HashBlock(block))
+	undo, err := c.blockStore.GetUndo(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := NewStoreBatch()
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		txHash := types.HashTransaction(block.Transactions[i])
+		for it := range block.Transactions[i].Outputs {
+			batch.DeleteUTXO(utxoKey(hex.EncodeToString(txHash), it))
+			batch.DeleteStateLeaf(stateKey(txHash, it))
+		}
+	}
+	for _, utxo := range undo.Spent {
+		batch.PutUTXO(utxo)
+		batch.PutStateLeaf(utxo)
+	}
+	batch.SetBestBlock(c.tip.Parent.Hash)
+
+	if err := c.commit(batch); err != nil {
+		return nil, err
+	}
+
+	c.headers.RemoveLast()
+	c.tip = c.tip.Parent
+	c.disconnectStake(block, undo.Spent)
+	c.state = disconnectState(c.state, block, undo.Spent)
+	c.emit(ChainEvent{Type: BlockDisconnected, Block: block})
+	return block, nil
+}
+
+// reorg makes the branch ending in target the main chain. It disconnects the
+// blocks back to the common ancestor and connects the blocks of the new
+// branch. If a block of the new branch turns out to be invalid, the branch is
+// marked invalid and the old main chain is restored.
+func (c *Chain) reorg(target *BlockNode) error {
+	fork := c.findFork(target)
+
+	var detached []*proto.Block
+	for c.tip != fork {
+		block, err := c.disconnectTip()
+		if err != nil {
+			return err
+		}
+		detached = append(detached, block)
+	}
+
+	var attach []*BlockNode
+	for node := target; node != fork; node = node.Parent {
+		attach = append(attach, node)
+	}
+
+	for i := len(attach) - 1; i >= 0; i-- {
+		if err := c.connectNode(attach[i]); err != nil {
+			c.markInvalid(attach[i])
+
+			for c.tip != fork {
+				if _, err := c.disconnectTip(); err != nil {
+					return err
+				}
+			}
+			for j := len(detached) - 1; j >= 0; j-- {
+				if err := c.addBlock(detached[j]); err != nil {
+					return err
+				}
+			}
+			return fmt.Errorf("reorg to %s failed: %w", target.Hash, err)
+		}
+	}
+
+	return nil
+}
+
+// connectNode validates the stored block of the node and connects it to the tip
+func (c *Chain) connectNode(node *BlockNode) error {
+	block, err := c.blockStore.Get(node.Hash)
+	if err != nil {
+		return err
+	}
+	if err := c.validateBlock(block); err != nil {
+		return err
+	}
+	return c.addBlock(block)
+}
+
+// findFork returns the last block the branch ending in node shares with the main chain
+func (c *Chain) findFork(node *BlockNode) *BlockNode {
+	for !c.isMainChain(node) {
+		node = node.Parent
+	}
+	return node
+}
+
+// isMainChain returns true if the node is part of the main chain
+func (c *Chain) isMainChain(node *BlockNode) bool {
+	return node.Height <= c.headers.Height() && c.tip.Ancestor(node.Height) == node
+}
+
+// markInvalid marks the node and all its descendants as invalid
+func (c *Chain) markInvalid(node *BlockNode) {
+	node.Invalid = true
+	for _, n := range c.index.nodes {
+		if n.Height > node.Height && n.Ancestor(node.Height) == node {
+			n.Invalid = true
+		}
+	}
 }
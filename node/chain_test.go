@@ -9,21 +9,45 @@ import (
 	"github.com/fzft/crypto-prd-blockchain/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"math"
+	"math/big"
 	"testing"
+	"time"
 )
 
+// godSeed is the seed of the key funded by the test genesis
+const godSeed = "b3853c01222f908d08a87d0dd8ce7b0d1324d9967b5da9342ee185d5c1ee295e"
+
+// testGenesis returns a genesis that pays 1000 to the god key
+func testGenesis() *Genesis {
+	prvKey := crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+	genesis := &Genesis{
+		ChainID:   "blocker-test",
+		Timestamp: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Consensus: types.DefaultConsensusParams(),
+	}
+	genesis.Alloc = []GenesisAlloc{
+		{Address: prvKey.PublicKey().Address().Encode(genesis.HRP()), Amount: 1000},
+	}
+	return genesis
+}
+
+func newTestChain(t *testing.T) *Chain {
+	chain, err := NewChain(testGenesis(), NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+	return chain
+}
+
+// randomBlock returns a signed block on top of the chain tip holding only a
+// coinbase.
 func randomBlock(t *testing.T, chain *Chain) *proto.Block {
-	prvKey := crypto.GeneratePrivateKey()
-	b := util.RandomBlock()
 	preBlock, err := chain.GetBlockByHeight(chain.Height())
 	require.Nil(t, err)
-	b.Header.PrevHash = types.HashBlock(preBlock)
-	types.SignBlock(prvKey, b)
-	return b
+	return childBlock(chain, preBlock)
 }
 
 func TestChainHeight(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore(), NewMemoryTxStore())
+	chain := newTestChain(t)
 	for i := 0; i < 10; i++ {
 		b := randomBlock(t, chain)
 		require.Nil(t, chain.AddBlock(b))
@@ -33,7 +57,8 @@ func TestChainHeight(t *testing.T) {
 
 func TestChainAddBlock(t *testing.T) {
 	bs := NewMemoryBlockStore()
-	chain := NewChain(bs, NewMemoryTxStore())
+	chain, err := NewChain(testGenesis(), bs, NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
 
 	for i := 0; i < 10; i++ {
 		block := randomBlock(t, chain)
@@ -51,53 +76,60 @@ func TestChainAddBlock(t *testing.T) {
 }
 
 func TestNewChain(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore(), NewMemoryTxStore())
+	chain := newTestChain(t)
 	assert.Equal(t, 0, chain.Height())
 
 	_, err := chain.GetBlockByHeight(0)
 	require.Nil(t, err)
 }
 
-func TestAddBlockWithTx(t *testing.T) {
-	var (
-		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTxStore())
-		b         = randomBlock(t, chain)
-		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
-		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
-	)
-
-	// hard code for genesis block
-	prevTx, err := chain.txStore.Get("28706e21cb96f758ee855577b6111cb8788d9b4c9eead5e19c09baa05ee16d90")
-
-	inputs := []*proto.TxInput{
-		{
-			PublicKey:    prvKey.PublicKey().Bytes(),
-			PrevOutIndex: 0,
-			PrevTxHash:   types.HashTransaction(prevTx),
-		},
-	}
-	outputs := []*proto.TxOutput{
-		{
-			Amount:  100,
-			Address: recipient,
-		},
-		{
-			Amount:  900,
-			Address: prvKey.PublicKey().Address().Bytes(),
-		},
-	}
+// genesisTx returns the transaction that funds the god key in the genesis block.
+func genesisTx(t *testing.T, chain *Chain) *proto.Transaction {
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	return genesis.Transactions[0]
+}
 
+// spendTx spends output outIndex of prevTx with the given key.
+func spendTx(prvKey *crypto.PrivateKey, prevTx *proto.Transaction, outIndex uint32, outputs ...*proto.TxOutput) *proto.Transaction {
 	tx := &proto.Transaction{
 		Version: 1,
-		Inputs:  inputs,
+		Inputs: []*proto.TxInput{
+			{
+				PublicKey:    prvKey.PublicKey().Bytes(),
+				PrevOutIndex: outIndex,
+				PrevTxHash:   types.HashTransaction(prevTx),
+			},
+		},
 		Outputs: outputs,
 	}
 
-	sig := types.SignTransaction(prvKey, tx)
-	tx.Inputs[0].Signature = sig.Bytes()
+	if err := types.SignTransaction(prvKey, tx); err != nil {
+		panic(err)
+	}
+	return tx
+}
 
+// addTxBlock adds a block holding the given transaction on top of the chain.
+func addTxBlock(t *testing.T, chain *Chain, tx *proto.Transaction) error {
+	b := randomBlock(t, chain)
 	b.Transactions = append(b.Transactions, tx)
-	require.Nil(t, chain.AddBlock(b))
+	signBlock(chain, crypto.GeneratePrivateKey(), b)
+	return chain.AddBlock(b)
+}
+
+func TestAddBlockWithTx(t *testing.T) {
+	var (
+		chain     = newTestChain(t)
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	)
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 100, Address: recipient},
+		&proto.TxOutput{Amount: 900, Address: prvKey.PublicKey().Address().Bytes()},
+	)
+	require.Nil(t, addTxBlock(t, chain, tx))
 
 	// check if all the outputs are unspent y querying the utxo store
 	txHash := hex.EncodeToString(types.HashTransaction(tx))
@@ -110,48 +142,659 @@ func TestAddBlockWithTx(t *testing.T) {
 		utxo, err := chain.utxoStore.Get(key)
 		require.Nil(t, err)
 		assert.Equal(t, txHash, utxo.Hash)
+		assert.Equal(t, tx.Outputs[i].Address, utxo.Address)
 		assert.True(t, !utxo.Spent)
 	}
 }
 
 func TestAddBlockWithTxInsufficientFunds(t *testing.T) {
 	var (
-		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTxStore())
-		b         = randomBlock(t, chain)
+		chain     = newTestChain(t)
 		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
 		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
 	)
 
-	// hard code for genesis block
-	prevTx, _ := chain.txStore.Get("28706e21cb96f758ee855577b6111cb8788d9b4c9eead5e19c09baa05ee16d90")
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 10001, Address: recipient},
+		&proto.TxOutput{Amount: 1, Address: prvKey.PublicKey().Address().Bytes()},
+	)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrInsufficientFunds)
+	assert.Equal(t, 0, chain.Height())
+}
 
-	inputs := []*proto.TxInput{
-		{
-			PublicKey:    prvKey.PublicKey().Bytes(),
-			PrevOutIndex: 0,
-			PrevTxHash:   types.HashTransaction(prevTx),
-		},
+func TestAddBlockWithTxWrongOwner(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		thief  = crypto.GeneratePrivateKey()
+		output = &proto.TxOutput{Amount: 1000, Address: thief.PublicKey().Address().Bytes()}
+	)
+
+	tx := spendTx(thief, genesisTx(t, chain), 0, output)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrWrongOwner)
+}
+
+func TestAddBlockWithTxInvalidSignature(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+	)
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	tx.Outputs[0].Amount--
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrInvalidTxSignature)
+
+	// the signature may leave other outputs open
+	tx.Outputs = append(tx.Outputs, &proto.TxOutput{Amount: 1, Address: addr})
+	require.Nil(t, types.SignInput(prvKey, tx, 0, types.SigHashSingle))
+	tx.Outputs[1].Address = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	assert.Nil(t, chain.ValidateTransaction(tx))
+
+	tx.Inputs[0].SigHash = 0x40
+	assert.ErrorIs(t, chain.ValidateTransaction(tx), ErrInvalidTxSignature)
+}
+
+func TestAddBlockWithTxUnknownInput(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		output = &proto.TxOutput{Amount: 1000, Address: prvKey.PublicKey().Address().Bytes()}
+	)
+
+	// the genesis transaction only has a single output
+	tx := spendTx(prvKey, genesisTx(t, chain), 1, output)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrUnknownInput)
+}
+
+func TestAddBlockWithTxInvalidAmount(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+	)
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 1100, Address: addr},
+		&proto.TxOutput{Amount: -100, Address: addr},
+	)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrInvalidAmount)
+
+	tx = spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 1000, Address: addr},
+		&proto.TxOutput{Amount: 0, Address: addr},
+	)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrInvalidAmount)
+}
+
+func TestAddBlockWithTxOverflow(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+	)
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: math.MaxInt64, Address: addr},
+		&proto.TxOutput{Amount: 1, Address: addr},
+	)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrAmountOverflow)
+}
+
+func TestAddBlockSpendsInputs(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+		prevTx = genesisTx(t, chain)
+	)
+
+	tx := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	require.Nil(t, addTxBlock(t, chain, tx))
+
+	spentKey := utxoKey(hex.EncodeToString(types.HashTransaction(prevTx)), 0)
+	_, err := chain.utxoStore.Get(spentKey)
+	assert.NotNil(t, err)
+
+	block, err := chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	undo, err := chain.blockStore.GetUndo(hex.EncodeToString(types.HashBlock(block)))
+	require.Nil(t, err)
+	require.Len(t, undo.Spent, 1)
+	assert.Equal(t, spentKey, undo.Spent[0].Key())
+
+	// the same output cannot be spent twice
+	double := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 999, Address: addr})
+	assert.ErrorIs(t, addTxBlock(t, chain, double), ErrUnknownInput)
+}
+
+func TestAddBlockConflictingTxs(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+		prevTx = genesisTx(t, chain)
+	)
+	tip, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	first := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	second := spendTx(prvKey, first, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	conflict := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 999, Address: addr})
+	twice := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	twice.Inputs = append(twice.Inputs, twice.Inputs[0])
+
+	for name, tc := range map[string]struct {
+		txx []*proto.Transaction
+		err error
+	}{
+		"duplicate transaction": {[]*proto.Transaction{first, first}, ErrDuplicateTx},
+		"double spend":          {[]*proto.Transaction{first, conflict}, ErrDoubleSpend},
+		"spend a later output":  {[]*proto.Transaction{second, first}, ErrSpendsLaterTx},
+		"duplicate input":       {[]*proto.Transaction{twice}, ErrDuplicateInput},
+	} {
+		err := chain.AddBlock(childBlock(chain, tip, tc.txx...))
+		assert.ErrorIs(t, err, tc.err, name)
+		assert.ErrorIs(t, err, ErrInvalidBlock, name)
+		assert.Equal(t, 0, chain.Height(), name)
 	}
-	outputs := []*proto.TxOutput{
-		{
-			Amount:  10001,
-			Address: recipient,
-		},
-		{
-			Amount:  1,
-			Address: prvKey.PublicKey().Address().Bytes(),
-		},
+
+	// a transaction may spend the outputs of the transactions before it
+	require.Nil(t, chain.AddBlock(childBlock(chain, tip, first, second)))
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(first)), 0))
+	assert.NotNil(t, err)
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(second)), 0))
+	assert.Nil(t, err)
+}
+
+func TestDisconnectTip(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+		prevTx = genesisTx(t, chain)
+	)
+
+	prevKey := utxoKey(hex.EncodeToString(types.HashTransaction(prevTx)), 0)
+	before, err := chain.utxoStore.Get(prevKey)
+	require.Nil(t, err)
+
+	tx := spendTx(prvKey, prevTx, 0,
+		&proto.TxOutput{Amount: 400, Address: addr},
+		&proto.TxOutput{Amount: 600, Address: addr},
+	)
+	require.Nil(t, addTxBlock(t, chain, tx))
+
+	block, err := chain.disconnectTip()
+	require.Nil(t, err)
+	assert.Equal(t, tx, block.Transactions[1])
+	assert.Equal(t, 0, chain.Height())
+
+	after, err := chain.utxoStore.Get(prevKey)
+	require.Nil(t, err)
+	assert.Equal(t, before, after)
+
+	txHash := hex.EncodeToString(types.HashTransaction(tx))
+	for i := range tx.Outputs {
+		_, err := chain.utxoStore.Get(utxoKey(txHash, i))
+		assert.NotNil(t, err)
 	}
 
-	tx := &proto.Transaction{
-		Version: 1,
-		Inputs:  inputs,
-		Outputs: outputs,
+	// the restored output can be spent again
+	require.Nil(t, addTxBlock(t, chain, tx))
+	assert.Equal(t, 1, chain.Height())
+
+	_, err = chain.disconnectTip()
+	require.Nil(t, err)
+	_, err = chain.disconnectTip()
+	assert.NotNil(t, err)
+}
+
+// childBlock returns a block on top of parent holding the given transactions
+// signed by a random key.
+func childBlock(chain *Chain, parent *proto.Block, txx ...*proto.Transaction) *proto.Block {
+	return validatorBlock(chain, parent, crypto.GeneratePrivateKey(), txx...)
+}
+
+// validatorBlock returns a block on top of parent holding the given
+// transactions signed by the key.
+func validatorBlock(chain *Chain, parent *proto.Block, key *crypto.PrivateKey, txx ...*proto.Transaction) *proto.Block {
+	var (
+		height = parent.Header.Height + 1
+		b      = util.RandomBlock()
+	)
+	b.Header.Version = types.BlockVersion
+	b.Header.Height = height
+	b.Header.PrevHash = types.HashBlock(parent)
+	b.Header.ValidatorsHash = parent.Header.NextValidatorsHash
+	b.Header.NextValidatorsHash = parent.Header.NextValidatorsHash
+	b.Transactions = append([]*proto.Transaction{types.GenerateCoinbaseTx(height, key.PublicKey().Address().Bytes(), 1)}, txx...)
+	signBlock(chain, key, b)
+	return b
+}
+
+// slotBlock returns a block on top of the chain tip signed by key at the
+// given delay after the tip.
+func slotBlock(t *testing.T, chain *Chain, key *crypto.PrivateKey, delay time.Duration) *proto.Block {
+	tip, err := chain.GetBlockByHeight(chain.Height())
+	require.Nil(t, err)
+
+	block := validatorBlock(chain, tip, key)
+	block.Header.Timestamp = tip.Header.Timestamp + int64(delay)
+	types.SignBlock(key, block)
+	return block
+}
+
+// buildBlock builds a block of the producer, a random one if nil, on top of
+// the chain tip with the given evidence and as many of the given
+// transactions as are valid, and adds it to the chain. The block is at least
+// a second after the tip. The transactions left out are returned.
+func buildBlock(t *testing.T, chain *Chain, producer *crypto.PrivateKey, evidence []*proto.Evidence, txx ...*proto.Transaction) (*proto.Block, []*proto.Transaction) {
+	if producer == nil {
+		producer = crypto.GeneratePrivateKey()
+	}
+	now := time.Now()
+	if next := time.Unix(0, chain.Tip().Header.Timestamp).Add(time.Second); next.After(now) {
+		now = next
 	}
 
-	sig := types.SignTransaction(prvKey, tx)
-	tx.Inputs[0].Signature = sig.Bytes()
+	block, leftover, err := chain.BuildBlock(producer.PublicKey(), txx, evidence, now)
+	require.Nil(t, err)
+	require.Len(t, block.Evidence, len(evidence))
+	require.Nil(t, chain.Engine().Seal(chain, block, producer, nil))
+	require.Nil(t, chain.AddBlock(block))
+	return block, leftover
+}
 
-	b.Transactions = append(b.Transactions, tx)
+// signedRandomBlock returns a random block signed by a random key.
+func signedRandomBlock() *proto.Block {
+	b := util.RandomBlock()
+	types.SignBlock(crypto.GeneratePrivateKey(), b)
+	return b
+}
+
+// signBlock sets the state root of the block and signs it. The state is
+// replayed from the genesis over the blocks the chain has stored, so the
+// parent may be on a side branch. Blocks on unknown parents get no state root.
+func signBlock(chain *Chain, prvKey *crypto.PrivateKey, b *proto.Block) {
+	var (
+		parents []*proto.Block
+		state   = util.NewSparseMerkleTree()
+	)
+	for hash := b.Header.PrevHash; ; {
+		parent, err := chain.GetBlockByHash(hash)
+		if err != nil {
+			parents = nil
+			break
+		}
+		parents = append(parents, parent)
+		if parent.Header.Height == 0 {
+			break
+		}
+		hash = parent.Header.PrevHash
+	}
+
+	b.Header.StateRoot = nil
+	if len(parents) > 0 {
+		for i := len(parents) - 1; i >= 0; i-- {
+			state = connectState(state, parents[i])
+		}
+		b.Header.StateRoot = connectState(state, b).Root()
+	}
+	types.SignBlock(prvKey, b)
+}
+
+func TestChainReorg(t *testing.T) {
+	var (
+		chain   = newTestChain(t)
+		prvKey  = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		prevTx  = genesisTx(t, chain)
+		alice   = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		bob     = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		events  []ChainEvent
+		genesis *proto.Block
+		err     error
+	)
+	chain.Subscribe(func(e ChainEvent) { events = append(events, e) })
+	genesis, err = chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	txA := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: alice})
+	a1 := childBlock(chain, genesis, txA)
+	require.Nil(t, chain.AddBlock(a1))
+	a2 := childBlock(chain, a1)
+	require.Nil(t, chain.AddBlock(a2))
+
+	txB := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: bob})
+	b1 := childBlock(chain, genesis, txB)
+
+	// the side branch is stored but not connected while it is not longer
+	require.Nil(t, chain.AddBlock(b1))
+	b2 := childBlock(chain, b1)
+	require.Nil(t, chain.AddBlock(b2))
+	assert.Equal(t, hex.EncodeToString(types.HashBlock(a2)), chain.Tip().Hash)
+	assert.ErrorIs(t, chain.AddBlock(b2), ErrKnownBlock)
+
+	events = nil
+	b3 := childBlock(chain, b2)
+	require.Nil(t, chain.AddBlock(b3))
+	assert.Equal(t, 3, chain.Height())
+	assert.Equal(t, hex.EncodeToString(types.HashBlock(b3)), chain.Tip().Hash)
+
+	fetched, err := chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	assert.Equal(t, b1, fetched)
+
+	require.Len(t, events, 5)
+	assert.Equal(t, ChainEvent{Type: BlockDisconnected, Block: a2}, events[0])
+	assert.Equal(t, ChainEvent{Type: BlockDisconnected, Block: a1}, events[1])
+	assert.Equal(t, ChainEvent{Type: BlockConnected, Block: b1}, events[2])
+	assert.Equal(t, ChainEvent{Type: BlockConnected, Block: b3}, events[4])
+
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(txA)), 0))
+	assert.NotNil(t, err)
+	utxo, err := chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(txB)), 0))
+	require.Nil(t, err)
+	assert.Equal(t, bob, utxo.Address)
+}
+
+func TestChainReorgInvalidBranch(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		prevTx = genesisTx(t, chain)
+		alice  = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	txA := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: alice})
+	a1 := childBlock(chain, genesis, txA)
+	require.Nil(t, chain.AddBlock(a1))
+
+	// the branch overspends the genesis output, which is only noticed on connect
+	bad := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 5000, Address: alice})
+	b1 := childBlock(chain, genesis)
+	require.Nil(t, chain.AddBlock(b1))
+	b2 := childBlock(chain, b1, bad)
+	assert.ErrorIs(t, chain.AddBlock(b2), ErrInsufficientFunds)
+
+	assert.Equal(t, 1, chain.Height())
+	assert.Equal(t, hex.EncodeToString(types.HashBlock(a1)), chain.Tip().Hash)
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(txA)), 0))
+	require.Nil(t, err)
+
+	assert.ErrorIs(t, chain.AddBlock(childBlock(chain, b2)), ErrInvalidBlock)
+	assert.ErrorIs(t, chain.AddBlock(childBlock(chain, util.RandomBlock())), ErrOrphanBlock)
+}
+
+func TestHeaviestChain(t *testing.T) {
+	light := &BlockNode{Height: 10, Work: big.NewInt(10)}
+	heavy := &BlockNode{Height: 5, Work: big.NewInt(20)}
+
+	assert.True(t, HeaviestChain{}.Better(heavy, light))
+	assert.False(t, HeaviestChain{}.Better(light, heavy))
+	assert.True(t, LongestChain{}.Better(light, heavy))
+}
+
+func TestMedianTime(t *testing.T) {
+	var node *BlockNode
+	for _, timestamp := range []int64{10, 50, 20, 40, 30} {
+		node = &BlockNode{Header: &proto.Header{Timestamp: timestamp}, Parent: node}
+	}
+	assert.Equal(t, int64(30), node.MedianTime(5))
+	assert.Equal(t, int64(30), node.MedianTime(3))
+	assert.Equal(t, int64(40), node.MedianTime(2))
+	assert.Equal(t, int64(30), node.MedianTime(100))
+}
+
+func TestCheckHeader(t *testing.T) {
+	genesis := testGenesis()
+	genesis.Consensus.MedianTimeBlocks = 3
+	genesis.Consensus.MaxBlockTxs = 3
+	genesis.Consensus.MaxBlockBytes = 4096
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	// blocks at 1s, 3s and 2s after the genesis make the median 2s
+	start := time.Now().Add(-time.Minute)
+	for _, offset := range []time.Duration{1, 3, 2} {
+		b := randomBlock(t, chain)
+		b.Header.Timestamp = start.Add(offset * time.Second).UnixNano()
+		types.SignBlock(crypto.GeneratePrivateKey(), b)
+		require.Nil(t, chain.AddBlock(b))
+	}
+
+	for name, test := range map[string]struct {
+		modify func(b *proto.Block)
+		err    error
+	}{
+		"unknown version": {func(b *proto.Block) { b.Header.Version = types.BlockVersion + 1 }, ErrUnknownVersion},
+		"no version":      {func(b *proto.Block) { b.Header.Version = 0 }, ErrUnknownVersion},
+		"legacy version":  {func(b *proto.Block) { b.Header.Version = 1 }, ErrOldVersion},
+		"skipped height":  {func(b *proto.Block) { b.Header.Height++ }, ErrBadHeight},
+		"median time":     {func(b *proto.Block) { b.Header.Timestamp = start.Add(2 * time.Second).UnixNano() }, ErrTimeTooOld},
+		"future":          {func(b *proto.Block) { b.Header.Timestamp = time.Now().Add(time.Minute).UnixNano() }, ErrTimeTooNew},
+		"transactions": {func(b *proto.Block) {
+			b.Transactions = append(b.Transactions, &proto.Transaction{Version: 1}, &proto.Transaction{Version: 2}, &proto.Transaction{Version: 3})
+		}, ErrTooManyTxs},
+		"size": {func(b *proto.Block) {
+			b.Transactions = append(b.Transactions, &proto.Transaction{Version: 1, Outputs: []*proto.TxOutput{{Address: make([]byte, 4096)}}})
+		}, ErrBlockTooLarge},
+	} {
+		b := randomBlock(t, chain)
+		test.modify(b)
+		types.SignBlock(crypto.GeneratePrivateKey(), b)
+		err := chain.AddBlock(b)
+		assert.ErrorIs(t, err, test.err, name)
+		assert.ErrorIs(t, err, ErrInvalidBlock, name)
+	}
+
+	// a block just after the median time is fine
+	b := randomBlock(t, chain)
+	b.Header.Timestamp = start.Add(2*time.Second).UnixNano() + 1
+	types.SignBlock(crypto.GeneratePrivateKey(), b)
 	require.Nil(t, chain.AddBlock(b))
+
+	// side branches follow the same rules
+	parent, err := chain.GetBlockByHeight(2)
+	require.Nil(t, err)
+	side := childBlock(chain, parent)
+	side.Header.Timestamp = start.UnixNano()
+	types.SignBlock(crypto.GeneratePrivateKey(), side)
+	assert.ErrorIs(t, chain.AddBlock(side), ErrTimeTooOld)
+}
+
+func TestBuildBlock(t *testing.T) {
+	var (
+		chain     = newTestChain(t)
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		producer  = crypto.GeneratePrivateKey()
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		prevTx    = genesisTx(t, chain)
+	)
+
+	valid := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	double := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 999, Address: recipient})
+
+	block, leftover, err := chain.BuildBlock(producer.PublicKey(), []*proto.Transaction{valid, double}, nil, time.Now())
+	require.Nil(t, err)
+	assert.Equal(t, []*proto.Transaction{double}, leftover)
+	require.Len(t, block.Transactions, 2)
+	assert.True(t, types.IsCoinbaseTx(block.Transactions[0]))
+	assert.Equal(t, valid, block.Transactions[1])
+	assert.Equal(t, int32(1), block.Header.Height)
+
+	types.SignBlock(producer, block)
+	require.Nil(t, chain.AddBlock(block))
+
+	cbHash := hex.EncodeToString(types.HashTransaction(block.Transactions[0]))
+	utxo, err := chain.utxoStore.Get(utxoKey(cbHash, 0))
+	require.Nil(t, err)
+	assert.Equal(t, chain.Params().BlockReward, utxo.Amount)
+	assert.Equal(t, producer.PublicKey().Address().Bytes(), utxo.Address)
+}
+
+func TestBuildBlockSizeLimit(t *testing.T) {
+	genesis := testGenesis()
+	genesis.Consensus.MaxBlockBytes = blockOverhead + 100
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	var (
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		tx        = spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	)
+
+	// the transaction does not fit next to the room kept for the header
+	block, leftover, err := chain.BuildBlock(crypto.GeneratePrivateKey().PublicKey(), []*proto.Transaction{tx}, nil, time.Now())
+	require.Nil(t, err)
+	assert.Equal(t, []*proto.Transaction{tx}, leftover)
+	assert.Len(t, block.Transactions, 1)
+}
+
+func TestBuildBlockRewardOverflow(t *testing.T) {
+	genesis := testGenesis()
+	genesis.Consensus.BlockReward = math.MaxInt64
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	var (
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		tx        = spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 999, Address: recipient})
+	)
+
+	// the fee of the transaction does not fit next to the subsidy
+	_, _, err = chain.BuildBlock(crypto.GeneratePrivateKey().PublicKey(), []*proto.Transaction{tx}, nil, time.Now())
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
+
+// coinbaseBlock returns a signed block on top of the chain tip starting with
+// the given coinbase.
+func coinbaseBlock(t *testing.T, chain *Chain, cb *proto.Transaction, txx ...*proto.Transaction) *proto.Block {
+	b := randomBlock(t, chain)
+	b.Transactions = append([]*proto.Transaction{cb}, txx...)
+	signBlock(chain, crypto.GeneratePrivateKey(), b)
+	return b
+}
+
+func TestAddBlockInvalidCoinbase(t *testing.T) {
+	var (
+		chain    = newTestChain(t)
+		producer = crypto.GeneratePrivateKey()
+		addr     = producer.PublicKey().Address().Bytes()
+		reward   = chain.Params().BlockReward
+	)
+
+	greedy := types.GenerateCoinbaseTx(1, addr, reward+1)
+	assert.ErrorIs(t, chain.AddBlock(coinbaseBlock(t, chain, greedy)), ErrInvalidCoinbase)
+
+	wrongHeight := types.GenerateCoinbaseTx(2, addr, reward)
+	assert.ErrorIs(t, chain.AddBlock(coinbaseBlock(t, chain, wrongHeight)), ErrInvalidCoinbase)
+
+	empty := randomBlock(t, chain)
+	empty.Transactions = nil
+	types.SignBlock(producer, empty)
+	assert.ErrorIs(t, chain.AddBlock(empty), ErrInvalidCoinbase)
+
+	assert.ErrorIs(t, addTxBlock(t, chain, types.GenerateCoinbaseTx(1, addr, reward)), ErrInvalidCoinbase)
+
+	// the producer may give up the reward
+	burn := types.GenerateCoinbaseTx(1, addr, reward)
+	burn.Outputs = nil
+	require.Nil(t, chain.AddBlock(coinbaseBlock(t, chain, burn)))
+
+	require.Nil(t, chain.AddBlock(coinbaseBlock(t, chain, types.GenerateCoinbaseTx(2, addr, reward))))
+}
+
+func TestCoinbaseFees(t *testing.T) {
+	var (
+		chain    = newTestChain(t)
+		prvKey   = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		producer = crypto.GeneratePrivateKey()
+		addr     = producer.PublicKey().Address().Bytes()
+		reward   = chain.Params().BlockReward
+	)
+
+	// 1000 in, 990 out leaves a fee of 10
+	tx := spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 990, Address: addr})
+
+	greedy := types.GenerateCoinbaseTx(1, addr, reward+11)
+	assert.ErrorIs(t, chain.AddBlock(coinbaseBlock(t, chain, greedy, tx)), ErrInvalidCoinbase)
+
+	block, leftover, err := chain.BuildBlock(producer.PublicKey(), []*proto.Transaction{tx}, nil, time.Now())
+	require.Nil(t, err)
+	assert.Empty(t, leftover)
+	assert.Equal(t, reward+10, block.Transactions[0].Outputs[0].Amount)
+
+	types.SignBlock(producer, block)
+	require.Nil(t, chain.AddBlock(block))
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	genesis := testGenesis()
+	genesis.Consensus.CoinbaseMaturity = 2
+
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	var (
+		producer = crypto.GeneratePrivateKey()
+		addr     = producer.PublicKey().Address().Bytes()
+	)
+
+	cb := types.GenerateCoinbaseTx(1, addr, chain.Params().BlockReward)
+	require.Nil(t, chain.AddBlock(coinbaseBlock(t, chain, cb)))
+
+	utxo, err := chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(cb)), 0))
+	require.Nil(t, err)
+	assert.True(t, utxo.Coinbase)
+	assert.Equal(t, 1, utxo.Height)
+
+	tx := spendTx(producer, cb, 0, &proto.TxOutput{Amount: 50, Address: addr})
+	assert.ErrorIs(t, chain.ValidateTransaction(tx), ErrImmatureCoinbase)
+	assert.ErrorIs(t, addTxBlock(t, chain, tx), ErrImmatureCoinbase)
+
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	require.Nil(t, chain.ValidateTransaction(tx))
+	require.Nil(t, addTxBlock(t, chain, tx))
+}
+
+func TestChainLocator(t *testing.T) {
+	chain := newTestChain(t)
+	for i := 0; i < 30; i++ {
+		require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	}
+
+	locator := chain.Locator()
+	tip, err := chain.GetBlockByHeight(30)
+	require.Nil(t, err)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	assert.Equal(t, types.HashBlock(tip), locator[0])
+	assert.Equal(t, types.HashBlock(genesis), locator[len(locator)-1])
+	assert.Less(t, len(locator), 30)
+}
+
+func TestChainHeadersAfter(t *testing.T) {
+	chain := newTestChain(t)
+	for i := 0; i < 10; i++ {
+		require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	}
+
+	block, err := chain.GetBlockByHeight(4)
+	require.Nil(t, err)
+
+	headers := chain.HeadersAfter([][]byte{util.RandomHash(), types.HashBlock(block)}, 3)
+	require.Len(t, headers, 3)
+	for i, header := range headers {
+		expected, err := chain.GetBlockByHeight(5 + i)
+		require.Nil(t, err)
+		assert.Equal(t, expected.Header, header)
+	}
+
+	// unknown locators start at genesis
+	assert.Len(t, chain.HeadersAfter([][]byte{util.RandomHash()}, 100), 10)
 }
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// poaChain returns a chain run by the given validators whose genesis was
+// created an hour ago.
+func poaChain(t *testing.T, keys ...*crypto.PrivateKey) *Chain {
+	genesis := testGenesis()
+	genesis.Timestamp = time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, key := range keys {
+		genesis.Validators = append(genesis.Validators, key.PublicKey().Bytes())
+	}
+
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+	return chain
+}
+
+func TestPoAChain(t *testing.T) {
+	var (
+		keys  = []*crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+		chain = poaChain(t, keys...)
+		other = crypto.GeneratePrivateKey()
+	)
+
+	assert.True(t, chain.IsValidator(keys[0].PublicKey().Bytes()))
+	assert.False(t, chain.IsValidator(other.PublicKey().Bytes()))
+
+	// height 1 belongs to the second validator
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, keys[0], 5*time.Second)), consensus.ErrWrongProposer)
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, other, 5*time.Second)), consensus.ErrWrongProposer)
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, keys[1], 4*time.Second)), consensus.ErrOutsideSlot)
+	require.Nil(t, chain.AddBlock(slotBlock(t, chain, keys[1], 6*time.Second)))
+
+	// the third validator is offline, after the timeout its slot passes on
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, keys[0], 6*time.Second)), consensus.ErrWrongProposer)
+	require.Nil(t, chain.AddBlock(slotBlock(t, chain, keys[0], 16*time.Second)))
+	assert.Equal(t, 2, chain.Height())
+
+	// nobody can claim a slot that has not started yet
+	ahead := time.Since(time.Unix(0, chain.Tip().Header.Timestamp)) + 20*time.Second
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, keys[0], ahead)), consensus.ErrOutsideSlot)
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, keys[0], 2*time.Hour)), ErrTimeTooNew)
+}
+
+func TestPoACanPropose(t *testing.T) {
+	keys := []*crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+	chain := poaChain(t, keys...)
+
+	// an hour after genesis we are deep into the timeout rounds
+	var (
+		now      = time.Now()
+		poa      = chain.Engine().(*consensus.PoA)
+		round, _ = poa.Round(chain.Tip().Header, now.UnixNano())
+		proposer = keys[(1+round)%2]
+		waiting  = keys[(2+round)%2]
+	)
+	assert.True(t, chain.CanPropose(proposer.PublicKey().Bytes(), now))
+	assert.False(t, chain.CanPropose(waiting.PublicKey().Bytes(), now))
+
+	_, _, err := chain.BuildBlock(waiting.PublicKey(), nil, nil, now)
+	assert.ErrorIs(t, err, consensus.ErrNotProposer)
+
+	n := New(ServerConfig{PrivateKey: proposer, Chain: chain})
+	block, err := n.produceBlock()
+	require.Nil(t, err)
+	assert.Equal(t, proposer.PublicKey().Bytes(), block.PublicKey)
+}
+
+func TestPoWChain(t *testing.T) {
+	genesis := testGenesis()
+	genesis.Consensus.Engine = consensus.EnginePoW
+	genesis.Consensus.PowBits = 8
+
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	var (
+		miner = crypto.GeneratePrivateKey()
+		n     = New(ServerConfig{PrivateKey: miner, Chain: chain})
+	)
+	assert.True(t, chain.IsValidator(crypto.GeneratePrivateKey().PublicKey().Bytes()))
+
+	for i := 0; i < 3; i++ {
+		block, err := n.produceBlock()
+		require.Nil(t, err)
+		assert.Equal(t, uint64(1<<8), block.Header.Difficulty)
+		assert.Equal(t, -1, new(big.Int).SetBytes(types.HashBlock(block)).Cmp(consensus.Target(block.Header.Difficulty)))
+	}
+	assert.Equal(t, 3, chain.Height())
+	assert.Equal(t, big.NewInt(1+3<<8), chain.Tip().Work)
+
+	// a signed block without work is rejected
+	unmined, _, err := chain.BuildBlock(miner.PublicKey(), nil, nil, time.Now())
+	require.Nil(t, err)
+	target := consensus.Target(unmined.Header.Difficulty)
+	for types.SignBlock(miner, unmined); new(big.Int).SetBytes(types.HashBlock(unmined)).Cmp(target) < 0; types.SignBlock(miner, unmined) {
+		unmined.Header.Nonce++
+	}
+	assert.ErrorIs(t, chain.AddBlock(unmined), consensus.ErrInvalidSeal)
+}
+
+func TestPoWHeaviestChain(t *testing.T) {
+	genesis := testGenesis()
+	genesis.Consensus.Engine = consensus.EnginePoW
+	genesis.Consensus.PowBits = 4
+
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	var (
+		engine = chain.Engine()
+		miner  = crypto.GeneratePrivateKey()
+		tip, _ = chain.GetBlockByHeight(0)
+	)
+	mine := func(parent *proto.Block, difficulty uint64) *proto.Block {
+		block := childBlock(chain, parent)
+		block.Header.Difficulty = difficulty
+		engine.Finalize(chain, block)
+		require.Nil(t, engine.Seal(chain, block, miner, nil))
+		return block
+	}
+
+	// the work of a block is its difficulty
+	light := mine(tip, 1<<4)
+	require.Nil(t, chain.AddBlock(light))
+	assert.Equal(t, big.NewInt(1+1<<4), chain.Tip().Work)
+
+	// a heavier block at the same height does not replace the tip, blocks
+	// have to carry the difficulty the chain requires
+	heavy := mine(tip, 1<<6)
+	assert.ErrorIs(t, chain.AddBlock(heavy), consensus.ErrInvalidSeal)
+	assert.Equal(t, hex.EncodeToString(types.HashBlock(light)), chain.Tip().Hash)
+
+	// the branch with more work wins
+	side := mine(tip, 1<<4)
+	require.Nil(t, chain.AddBlock(side))
+	require.Nil(t, chain.AddBlock(mine(side, 1<<4)))
+	assert.Equal(t, 2, chain.Height())
+	assert.Equal(t, big.NewInt(1+2<<4), chain.Tip().Work)
+}
@@ -0,0 +1,72 @@
+package node
+
+import "errors"
+
+// Transaction validation errors. They are wrapped with the offending input or
+// output, so callers should match them with errors.Is.
+var (
+	ErrMalformedTx        = errors.New("malformed transaction")
+	ErrInvalidTxSignature = errors.New("invalid transaction signature")
+	ErrUnknownInput       = errors.New("unknown input")
+	ErrInputSpent         = errors.New("input already spent")
+	ErrDuplicateInput     = errors.New("duplicate input")
+	ErrWrongOwner         = errors.New("input not owned by spender")
+	ErrInvalidAmount      = errors.New("invalid amount")
+	ErrAmountOverflow     = errors.New("amount overflow")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrInvalidCoinbase    = errors.New("invalid coinbase")
+	ErrImmatureCoinbase   = errors.New("coinbase output not mature")
+	ErrBondedOutput       = errors.New("output is bonded")
+	ErrUnbonding          = errors.New("unbonding output not spendable yet")
+	ErrJailed             = errors.New("validator is jailed")
+)
+
+// Block errors.
+var (
+	ErrInvalidBlock = errors.New("invalid block")
+	ErrKnownBlock   = errors.New("block already known")
+	ErrOrphanBlock  = errors.New("orphan block")
+
+	// ErrConflictsWithCommit is returned for blocks and certificates that
+	// would revert a committed block
+	ErrConflictsWithCommit = errors.New("conflicts with a committed block")
+	ErrNoFinality          = errors.New("consensus engine has no finality")
+
+	// ErrInvalidEvidence is returned for evidence of double signing that
+	// does not prove an offense the chain can punish
+	ErrInvalidEvidence = errors.New("invalid evidence")
+
+	// ErrInvalidProof is returned for transaction and utxo proofs that do
+	// not match the header they are checked against
+	ErrInvalidProof = errors.New("invalid merkle proof")
+)
+
+// Header and block body errors. They are wrapped in ErrInvalidBlock, so callers can match
+// the broken rule or any invalid block.
+var (
+	ErrUnknownVersion = errors.New("unknown block version")
+	ErrOldVersion     = errors.New("block version older than its parent")
+	ErrBadHeight      = errors.New("block height does not follow its parent")
+	ErrTimeTooOld     = errors.New("block timestamp not after the median time")
+	ErrTimeTooNew     = errors.New("block timestamp too far in the future")
+	ErrTooManyTxs     = errors.New("too many transactions in block")
+	ErrBlockTooLarge  = errors.New("block too large")
+	ErrDuplicateTx    = errors.New("duplicate transaction in block")
+	ErrDoubleSpend    = errors.New("output spent twice in block")
+	ErrSpendsLaterTx  = errors.New("input created later in block")
+	ErrStateRoot      = errors.New("state root does not match the utxo set")
+)
+
+// ErrStoreInconsistent is returned once a block could only be partly written
+// to the stores. The node has to be restarted to repair the stores.
+var ErrStoreInconsistent = errors.New("stores are inconsistent")
+
+// ErrCorruptRecord is returned when a store file holds a broken record that
+// is followed by more data, so it is no torn write of a crash
+var ErrCorruptRecord = errors.New("corrupt record")
+
+// Genesis errors.
+var (
+	ErrInvalidGenesis  = errors.New("invalid genesis")
+	ErrGenesisMismatch = errors.New("genesis mismatch")
+)
@@ -0,0 +1,117 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"sort"
+	"sync"
+)
+
+// EvidencePool collects evidence of validators signing two blocks at the same
+// height until it is included in a block. To catch the second block it
+// remembers the first block every producer signed at every height.
+type EvidencePool struct {
+	lock     sync.Mutex
+	signed   map[string]*proto.Block    // by producer and height
+	evidence map[string]*proto.Evidence // by offender
+}
+
+func NewEvidencePool() *EvidencePool {
+	return &EvidencePool{
+		signed:   make(map[string]*proto.Block),
+		evidence: make(map[string]*proto.Evidence),
+	}
+}
+
+func signedKey(pubKey []byte, height int32) string {
+	return fmt.Sprintf("%x/%d", pubKey, height)
+}
+
+// CheckBlock records the signed block and returns evidence if its producer
+// signed a different block at the same height before. The signature of the
+// block has to be checked by the caller.
+func (p *EvidencePool) CheckBlock(block *proto.Block) *proto.Evidence {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := signedKey(block.PublicKey, block.Header.Height)
+	first, ok := p.signed[key]
+	if !ok {
+		p.signed[key] = block
+		return nil
+	}
+	if bytes.Equal(types.HashBlock(first), types.HashBlock(block)) {
+		return nil
+	}
+	return types.NewEvidence(first, block)
+}
+
+// Has returns true if the pool holds evidence against the offender of the
+// given evidence.
+func (p *EvidencePool) Has(evidence *proto.Evidence) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.evidence[hex.EncodeToString(evidence.PublicKey)]
+	return ok
+}
+
+// Add adds the evidence to the pool. It returns false if the pool already
+// holds evidence against the offender.
+func (p *EvidencePool) Add(evidence *proto.Evidence) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	offender := hex.EncodeToString(evidence.PublicKey)
+	if _, ok := p.evidence[offender]; ok {
+		return false
+	}
+	p.evidence[offender] = evidence
+	return true
+}
+
+// Remove removes the evidence against the offender of the given evidence
+func (p *EvidencePool) Remove(evidence *proto.Evidence) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.evidence, hex.EncodeToString(evidence.PublicKey))
+}
+
+// Pending returns the evidence waiting to be included in a block, ordered by
+// offender
+func (p *EvidencePool) Pending() []*proto.Evidence {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	offenders := make([]string, 0, len(p.evidence))
+	for offender := range p.evidence {
+		offenders = append(offenders, offender)
+	}
+	sort.Strings(offenders)
+
+	pending := make([]*proto.Evidence, len(offenders))
+	for i, offender := range offenders {
+		pending[i] = p.evidence[offender]
+	}
+	return pending
+}
+
+// Prune forgets the blocks signed below the given height and the evidence of
+// double signing below it, it can no longer be punished.
+func (p *EvidencePool) Prune(height int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for key, block := range p.signed {
+		if int(block.Header.Height) < height {
+			delete(p.signed, key)
+		}
+	}
+	for offender, evidence := range p.evidence {
+		if int(evidence.HeaderA.Height) < height {
+			delete(p.evidence, offender)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package node
+
+import (
+	"context"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// doubleSign returns two different blocks of the key on top of the chain tip
+func doubleSign(t *testing.T, chain *Chain, key *crypto.PrivateKey) (*proto.Block, *proto.Block) {
+	return slotBlock(t, chain, key, 6*time.Second), slotBlock(t, chain, key, 7*time.Second)
+}
+
+func TestEvidencePool(t *testing.T) {
+	var (
+		pool  = NewEvidencePool()
+		chain = newTestChain(t)
+		key   = crypto.GeneratePrivateKey()
+		a, b  = doubleSign(t, chain, key)
+	)
+
+	assert.Nil(t, pool.CheckBlock(a))
+	assert.Nil(t, pool.CheckBlock(a))
+	evidence := pool.CheckBlock(b)
+	require.NotNil(t, evidence)
+	assert.True(t, types.VerifyEvidence(evidence))
+	assert.Equal(t, key.PublicKey().Bytes(), evidence.PublicKey)
+
+	assert.True(t, pool.Add(evidence))
+	assert.False(t, pool.Add(types.NewEvidence(b, a)))
+	assert.True(t, pool.Has(evidence))
+	assert.Equal(t, []*proto.Evidence{evidence}, pool.Pending())
+
+	pool.Remove(evidence)
+	assert.Empty(t, pool.Pending())
+
+	// evidence below the pruned height can no longer be punished
+	pool.Add(evidence)
+	pool.Prune(1)
+	assert.Len(t, pool.Pending(), 1)
+	pool.Prune(2)
+	assert.Empty(t, pool.Pending())
+	assert.Nil(t, pool.CheckBlock(b))
+}
+
+func TestChainEvidence(t *testing.T) {
+	var (
+		keys  = []*crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+		chain = poaChain(t, keys...)
+	)
+
+	// height 1 belongs to the second validator, which signs two blocks
+	a, b := doubleSign(t, chain, keys[1])
+	require.Nil(t, chain.AddBlock(a))
+	require.Nil(t, chain.AddBlock(b))
+	evidence := types.NewEvidence(a, b)
+	require.Nil(t, chain.ValidateEvidence(evidence))
+
+	// only validators can be punished
+	other := crypto.GeneratePrivateKey()
+	x, y := doubleSign(t, chain, other)
+	assert.ErrorIs(t, chain.ValidateEvidence(types.NewEvidence(x, y)), ErrInvalidEvidence)
+	assert.ErrorIs(t, chain.ValidateEvidence(types.NewEvidence(a, a)), ErrInvalidEvidence)
+
+	// the block punishing the offender leaves it out of the next set
+	block := slotBlock(t, chain, keys[2], 6*time.Second)
+	block.Evidence = []*proto.Evidence{evidence, evidence}
+	types.SignBlock(keys[2], block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrInvalidEvidence)
+
+	block.Evidence = []*proto.Evidence{evidence}
+	types.SignBlock(keys[2], block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrInvalidBlock)
+
+	next := [][]byte{keys[0].PublicKey().Bytes(), keys[2].PublicKey().Bytes()}
+	block.Header.NextValidatorsHash = types.HashValidators(next)
+	types.SignBlock(keys[2], block)
+	require.Nil(t, chain.AddBlock(block))
+
+	assert.Equal(t, next, chain.Validators(chain.Tip().Header))
+	assert.False(t, chain.IsValidator(keys[1].PublicKey().Bytes()))
+	assert.ErrorIs(t, chain.ValidateEvidence(evidence), ErrInvalidEvidence)
+
+	// height 3 belongs to the second validator of the remaining two
+	assert.ErrorIs(t, chain.AddBlock(slotBlock(t, chain, keys[1], 6*time.Second)), consensus.ErrWrongProposer)
+	require.Nil(t, chain.AddBlock(slotBlock(t, chain, keys[2], 6*time.Second)))
+
+	// disconnecting the punishing block releases the offender
+	_, err := chain.disconnectTip()
+	require.Nil(t, err)
+	_, err = chain.disconnectTip()
+	require.Nil(t, err)
+	assert.True(t, chain.IsValidator(keys[1].PublicKey().Bytes()))
+	assert.Nil(t, chain.ValidateEvidence(evidence))
+}
+
+func TestHandleDoubleSign(t *testing.T) {
+	var (
+		keys = []*crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+		n    = New(ServerConfig{Chain: poaChain(t, keys...)})
+		a, b = doubleSign(t, n.Chain, keys[1])
+	)
+
+	_, err := n.HandleBlock(context.Background(), a)
+	require.Nil(t, err)
+	assert.Empty(t, n.evidence.Pending())
+	_, err = n.HandleBlock(context.Background(), b)
+	require.Nil(t, err)
+	require.Len(t, n.evidence.Pending(), 1)
+
+	// relayed evidence is only taken once
+	evidence := n.evidence.Pending()[0]
+	_, err = n.HandleEvidence(context.Background(), evidence)
+	require.Nil(t, err)
+	_, err = n.HandleEvidence(context.Background(), &proto.Evidence{PublicKey: keys[0].PublicKey().Bytes()})
+	assert.ErrorIs(t, err, ErrInvalidEvidence)
+
+	// the next block includes the evidence
+	block := slotBlock(t, n.Chain, keys[0], 6*time.Second)
+	block.Evidence = n.evidence.Pending()
+	block.Header.NextValidatorsHash = types.HashValidators([][]byte{keys[0].PublicKey().Bytes()})
+	types.SignBlock(keys[0], block)
+	_, err = n.HandleBlock(context.Background(), block)
+	require.Nil(t, err)
+	assert.Empty(t, n.evidence.Pending())
+}
+
+// doubleSignChain returns a chain whose only validator, which holds the
+// stake bonded by the returned transaction, signed two blocks at height 3.
+// The first one is connected, the evidence of the offense is returned.
+func doubleSignChain(t *testing.T) (*Chain, *crypto.PrivateKey, *proto.Transaction, *proto.Evidence) {
+	var (
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr      = prvKey.PublicKey().Address().Bytes()
+		validator = crypto.GeneratePrivateKey()
+		pubKey    = validator.PublicKey().Bytes()
+		genesis   = stakeGenesis()
+	)
+	genesis.Consensus.BlockTime = 1
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	bond := typedTx(prvKey, proto.TxType_BOND, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 900, Address: addr, Validator: pubKey},
+		&proto.TxOutput{Amount: 100, Address: addr},
+	)
+	buildBlock(t, chain, nil, nil, bond)
+	buildBlock(t, chain, nil, nil)
+	require.Equal(t, [][]byte{pubKey}, chain.Validators(chain.Tip().Header))
+
+	next := time.Unix(0, chain.Tip().Header.Timestamp).Add(time.Second)
+	a, _, err := chain.BuildBlock(validator.PublicKey(), nil, nil, next)
+	require.Nil(t, err)
+	b, _, err := chain.BuildBlock(validator.PublicKey(), nil, nil, next.Add(time.Millisecond))
+	require.Nil(t, err)
+	types.SignBlock(validator, a)
+	types.SignBlock(validator, b)
+	require.Nil(t, chain.AddBlock(a))
+	return chain, validator, bond, types.NewEvidence(a, b)
+}
+
+func TestSlashJailedStake(t *testing.T) {
+	var (
+		chain, validator, bond, evidence = doubleSignChain(t)
+
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+		pubKey = validator.PublicKey().Bytes()
+	)
+
+	// the offender is jailed before the transactions of the same block, its
+	// stake is slashed when it is unbonded next to the evidence
+	greedy := typedTx(prvKey, proto.TxType_UNBOND, bond, 0, &proto.TxOutput{Amount: 900, Address: addr, Validator: pubKey})
+	assert.Nil(t, chain.ValidateTransaction(greedy))
+	_, leftover := buildBlock(t, chain, validator, []*proto.Evidence{evidence}, greedy)
+	assert.Equal(t, []*proto.Transaction{greedy}, leftover)
+
+	// the last validator stays in office, the chain has to go on
+	assert.Equal(t, [][]byte{pubKey}, chain.Validators(chain.Tip().Header))
+
+	// no new stake is bonded to a jailed validator and its stake is slashed
+	rebond := typedTx(prvKey, proto.TxType_BOND, bond, 1, &proto.TxOutput{Amount: 100, Address: addr, Validator: pubKey})
+	assert.ErrorIs(t, chain.ValidateTransaction(rebond), ErrJailed)
+	assert.ErrorIs(t, chain.ValidateTransaction(greedy), ErrInsufficientFunds)
+	unbond := typedTx(prvKey, proto.TxType_UNBOND, bond, 0, &proto.TxOutput{Amount: 855, Address: addr, Validator: pubKey})
+	assert.Nil(t, chain.ValidateTransaction(unbond))
+
+	// stake unbonded after the jailing is not slashed a second time
+	buildBlock(t, chain, validator, nil, unbond)
+	buildBlock(t, chain, validator, nil)
+	buildBlock(t, chain, validator, nil)
+	spend := spendTx(prvKey, unbond, 0, &proto.TxOutput{Amount: 855, Address: addr})
+	assert.Nil(t, chain.ValidateTransaction(spend))
+}
+
+func TestSlashUnbondingStake(t *testing.T) {
+	var (
+		chain, validator, bond, evidence = doubleSignChain(t)
+
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+		pubKey = validator.PublicKey().Bytes()
+	)
+
+	// the offender unbonds its stake before the evidence is included
+	unbond := typedTx(prvKey, proto.TxType_UNBOND, bond, 0, &proto.TxOutput{Amount: 900, Address: addr, Validator: pubKey})
+	_, leftover := buildBlock(t, chain, validator, nil, unbond)
+	require.Empty(t, leftover)
+	assert.Equal(t, int64(0), chain.Stake(pubKey))
+	buildBlock(t, chain, validator, []*proto.Evidence{evidence})
+
+	// the locked stake is slashed all the same once the lock is over
+	greedy := spendTx(prvKey, unbond, 0, &proto.TxOutput{Amount: 900, Address: addr})
+	spend := spendTx(prvKey, unbond, 0, &proto.TxOutput{Amount: 855, Address: addr})
+	assert.ErrorIs(t, chain.ValidateTransaction(spend), ErrUnbonding)
+	buildBlock(t, chain, validator, nil)
+	assert.ErrorIs(t, chain.ValidateTransaction(greedy), ErrInsufficientFunds)
+	assert.Nil(t, chain.ValidateTransaction(spend))
+}
@@ -0,0 +1,664 @@
+package node
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	pb "github.com/golang/protobuf/proto"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	// maxBlockFileSize is the size at which a new block file is started
+	maxBlockFileSize = 128 << 20
+
+	recordHeaderLen = 8
+)
+
+// recordLog is an append-only file of length prefixed, checksummed records.
+// Every append is fsync'd. A record that was only partially written when the
+// process died is detected on open and cut off. A broken record anywhere else
+// is corruption, the log refuses to open.
+type recordLog struct {
+	file *os.File
+	size int64
+}
+
+// openRecordLog opens the log at path, creating it if needed. The records
+// starting at offset from are passed to fn. A torn record at the end of the
+// log is cut off, a broken record followed by more data fails with
+// ErrCorruptRecord.
+func openRecordLog(path string, from int64, fn func(offset int64, data []byte) error) (*recordLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := &recordLog{file: file, size: from}
+	for l.size < info.Size() {
+		data, err := l.ReadAt(l.size)
+		if err != nil {
+			if !l.tornAt(l.size, info.Size()) {
+				file.Close()
+				return nil, fmt.Errorf("%w in %s: %w", ErrCorruptRecord, path, err)
+			}
+			break
+		}
+		if fn != nil {
+			if err := fn(l.size, data); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		l.size += recordHeaderLen + int64(len(data))
+	}
+
+	if info.Size() > l.size {
+		// drop the torn write of a crash
+		if err := file.Truncate(l.size); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// tornAt returns true if the broken record at the given offset ends at or
+// beyond the end of a file of the given size, as the last record written
+// before a crash does
+func (l *recordLog) tornAt(offset, size int64) bool {
+	header := make([]byte, recordHeaderLen)
+	if _, err := l.file.ReadAt(header, offset); err != nil {
+		return true
+	}
+	return offset+recordHeaderLen+int64(binary.BigEndian.Uint32(header[0:4])) >= size
+}
+
+// Append appends a record and returns its offset
+func (l *recordLog) Append(data []byte) (int64, error) {
+	buf := make([]byte, recordHeaderLen+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	copy(buf[recordHeaderLen:], data)
+
+	offset := l.size
+	if _, err := l.file.WriteAt(buf, offset); err != nil {
+		return 0, err
+	}
+	if err := l.file.Sync(); err != nil {
+		return 0, err
+	}
+
+	l.size += int64(len(buf))
+	return offset, nil
+}
+
+// ReadAt reads the record at the given offset
+func (l *recordLog) ReadAt(offset int64) ([]byte, error) {
+	header := make([]byte, recordHeaderLen)
+	if _, err := l.file.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxBlockFileSize {
+		return nil, fmt.Errorf("record at offset %d is too large", offset)
+	}
+
+	data := make([]byte, length)
+	if _, err := l.file.ReadAt(data, offset+recordHeaderLen); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("checksum mismatch at offset %d", offset)
+	}
+	return data, nil
+}
+
+func (l *recordLog) Close() error {
+	return l.file.Close()
+}
+
+const (
+	opPut byte = iota + 1
+	opDelete
+)
+
+// fileKV is a log structured key value store. Every change is appended to a
+// record log, the current state is kept in memory and rebuilt from the log on
+// open.
+type fileKV struct {
+	lock sync.RWMutex
+	path string
+	log  *recordLog
+	data map[string][]byte
+}
+
+func openFileKV(path string) (*fileKV, error) {
+	kv := &fileKV{path: path, data: make(map[string][]byte)}
+
+	records := 0
+	log, err := openRecordLog(path, 0, func(_ int64, record []byte) error {
+		records++
+		return kv.apply(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	kv.log = log
+
+	if records > 2*len(kv.data)+1024 {
+		if err := kv.compact(); err != nil {
+			log.Close()
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+// apply applies an encoded put or delete to the in-memory state
+func (kv *fileKV) apply(record []byte) error {
+	if len(record) == 0 {
+		return fmt.Errorf("empty record in %s", kv.path)
+	}
+
+	keyLen, n := binary.Uvarint(record[1:])
+	if n <= 0 || uint64(len(record)-1-n) < keyLen {
+		return fmt.Errorf("corrupt record in %s", kv.path)
+	}
+	key := string(record[1+n : 1+n+int(keyLen)])
+
+	switch record[0] {
+	case opPut:
+		kv.data[key] = record[1+n+int(keyLen):]
+	case opDelete:
+		delete(kv.data, key)
+	default:
+		return fmt.Errorf("unknown record type %d in %s", record[0], kv.path)
+	}
+	return nil
+}
+
+func encodeKVRecord(op byte, key string, value []byte) []byte {
+	record := make([]byte, 1+binary.MaxVarintLen64+len(key)+len(value))
+	record[0] = op
+	n := binary.PutUvarint(record[1:], uint64(len(key)))
+	n += copy(record[1+n:], key)
+	n += copy(record[1+n:], value)
+	return record[:1+n]
+}
+
+// compact rewrites the log so that it only holds the current state
+func (kv *fileKV) compact() error {
+	tmpPath := kv.path + ".tmp"
+	os.Remove(tmpPath)
+
+	tmp, err := openRecordLog(tmpPath, 0, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range kv.data {
+		if _, err := tmp.Append(encodeKVRecord(opPut, key, value)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := kv.log.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, kv.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(kv.path)); err != nil {
+		return err
+	}
+
+	kv.log, err = openRecordLog(kv.path, 0, nil)
+	return err
+}
+
+func (kv *fileKV) Get(key string) ([]byte, bool) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	value, ok := kv.data[key]
+	return value, ok
+}
+
+func (kv *fileKV) Put(key string, value []byte) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if _, err := kv.log.Append(encodeKVRecord(opPut, key, value)); err != nil {
+		return err
+	}
+	kv.data[key] = value
+	return nil
+}
+
+func (kv *fileKV) Delete(key string) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if _, ok := kv.data[key]; !ok {
+		return nil
+	}
+	if _, err := kv.log.Append(encodeKVRecord(opDelete, key, nil)); err != nil {
+		return err
+	}
+	delete(kv.data, key)
+	return nil
+}
+
+// All returns a copy of the current state
+func (kv *fileKV) All() map[string][]byte {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	data := make(map[string][]byte, len(kv.data))
+	for key, value := range kv.data {
+		data[key] = value
+	}
+	return data
+}
+
+func (kv *fileKV) Close() error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	return kv.log.Close()
+}
+
+// syncDir fsyncs a directory, so renames and new files in it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// blockLocation is the position of a block in the block files
+type blockLocation struct {
+	file   uint32
+	offset int64
+}
+
+const blockIndexEntryLen = 32 + 4 + 8
+
+// FileBlockStore stores blocks in append-only block files (blk00000.dat,
+// blk00001.dat, ...) and keeps an index file mapping block hashes to their
+// position. Blocks written to a block file but missing from the index, e.g.
+// after a crash, are indexed again on open.
+type FileBlockStore struct {
+	lock  sync.RWMutex
+	dir   string
+	files []*recordLog
+	index *recordLog
+	locs  map[string]blockLocation
+	undo  *fileKV
+
+	// commits holds the commit certificates of committed blocks
+	commits *fileKV
+}
+
+func NewFileBlockStore(dir string) (*FileBlockStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FileBlockStore{dir: dir, locs: make(map[string]blockLocation)}
+	if err := s.open(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileBlockStore) open() error {
+	// the offset of the last indexed block of every block file
+	lastIndexed := make(map[uint32]int64)
+
+	index, err := openRecordLog(filepath.Join(s.dir, "index.dat"), 0, func(_ int64, entry []byte) error {
+		if len(entry) != blockIndexEntryLen {
+			return fmt.Errorf("corrupt block index entry")
+		}
+		hash := hex.EncodeToString(entry[:32])
+		loc := blockLocation{
+			file:   binary.BigEndian.Uint32(entry[32:36]),
+			offset: int64(binary.BigEndian.Uint64(entry[36:44])),
+		}
+		s.locs[hash] = loc
+		if loc.offset > lastIndexed[loc.file] {
+			lastIndexed[loc.file] = loc.offset
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.index = index
+
+	names, err := filepath.Glob(filepath.Join(s.dir, "blk*.dat"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if name != blockFileName(s.dir, uint32(i)) {
+			return fmt.Errorf("unexpected block file %s", name)
+		}
+		if err := s.openBlockFile(uint32(i), lastIndexed[uint32(i)]); err != nil {
+			return err
+		}
+	}
+	if len(s.files) == 0 {
+		if err := s.openBlockFile(0, 0); err != nil {
+			return err
+		}
+	}
+
+	if s.undo, err = openFileKV(filepath.Join(s.dir, "undo.dat")); err != nil {
+		return err
+	}
+	s.commits, err = openFileKV(filepath.Join(s.dir, "commits.dat"))
+	return err
+}
+
+// openBlockFile opens a block file and indexes the blocks at or after the
+// given offset that are not indexed yet.
+func (s *FileBlockStore) openBlockFile(file uint32, from int64) error {
+	log, err := openRecordLog(blockFileName(s.dir, file), from, func(offset int64, data []byte) error {
+		block := new(proto.Block)
+		if err := pb.Unmarshal(data, block); err != nil {
+			return err
+		}
+		hash := hex.EncodeToString(types.HashBlock(block))
+		if _, ok := s.locs[hash]; ok {
+			return nil
+		}
+		return s.addIndexEntry(hash, blockLocation{file: file, offset: offset})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.files = append(s.files, log)
+	return nil
+}
+
+func blockFileName(dir string, file uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("blk%05d.dat", file))
+}
+
+func (s *FileBlockStore) addIndexEntry(hash string, loc blockLocation) error {
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil {
+		return err
+	}
+
+	entry := make([]byte, blockIndexEntryLen)
+	copy(entry, hashBytes)
+	binary.BigEndian.PutUint32(entry[32:36], loc.file)
+	binary.BigEndian.PutUint64(entry[36:44], uint64(loc.offset))
+	if _, err := s.index.Append(entry); err != nil {
+		return err
+	}
+
+	s.locs[hash] = loc
+	return nil
+}
+
+func (s *FileBlockStore) Put(block *proto.Block) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash := hex.EncodeToString(types.HashBlock(block))
+	if _, ok := s.locs[hash]; ok {
+		return nil
+	}
+
+	data, err := pb.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	file := uint32(len(s.files) - 1)
+	if s.files[file].size+int64(len(data)) > maxBlockFileSize && s.files[file].size > 0 {
+		file++
+		if err := s.openBlockFile(file, 0); err != nil {
+			return err
+		}
+	}
+
+	offset, err := s.files[file].Append(data)
+	if err != nil {
+		return err
+	}
+	return s.addIndexEntry(hash, blockLocation{file: file, offset: offset})
+}
+
+func (s *FileBlockStore) Get(hash string) (*proto.Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	loc, ok := s.locs[hash]
+	if !ok {
+		return nil, fmt.Errorf("block with hash %s not found", hash)
+	}
+
+	data, err := s.files[loc.file].ReadAt(loc.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	block := new(proto.Block)
+	if err := pb.Unmarshal(data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (s *FileBlockStore) PutUndo(hash string, undo *BlockUndo) error {
+	data, err := json.Marshal(undo)
+	if err != nil {
+		return err
+	}
+	return s.undo.Put(hash, data)
+}
+
+func (s *FileBlockStore) GetUndo(hash string) (*BlockUndo, error) {
+	data, ok := s.undo.Get(hash)
+	if !ok {
+		return nil, fmt.Errorf("undo data for block %s not found", hash)
+	}
+
+	undo := new(BlockUndo)
+	if err := json.Unmarshal(data, undo); err != nil {
+		return nil, err
+	}
+	return undo, nil
+}
+
+func (s *FileBlockStore) PutCommit(hash string, cert *proto.CommitCertificate) error {
+	data, err := pb.Marshal(cert)
+	if err != nil {
+		return err
+	}
+	return s.commits.Put(hash, data)
+}
+
+func (s *FileBlockStore) GetCommit(hash string) (*proto.CommitCertificate, error) {
+	data, ok := s.commits.Get(hash)
+	if !ok {
+		return nil, fmt.Errorf("commit of block %s not found", hash)
+	}
+
+	cert := new(proto.CommitCertificate)
+	if err := pb.Unmarshal(data, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+func (s *FileBlockStore) Close() error {
+	var errs []error
+	for _, file := range s.files {
+		errs = append(errs, file.Close())
+	}
+	if s.index != nil {
+		errs = append(errs, s.index.Close())
+	}
+	if s.undo != nil {
+		errs = append(errs, s.undo.Close())
+	}
+	if s.commits != nil {
+		errs = append(errs, s.commits.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// FileTxStore stores transactions in a log structured file
+type FileTxStore struct {
+	txx *fileKV
+}
+
+func NewFileTxStore(dir string) (*FileTxStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	txx, err := openFileKV(filepath.Join(dir, "txs.dat"))
+	if err != nil {
+		return nil, err
+	}
+	return &FileTxStore{txx: txx}, nil
+}
+
+func (s *FileTxStore) Put(tx *proto.Transaction) error {
+	data, err := pb.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	return s.txx.Put(hex.EncodeToString(types.HashTransaction(tx)), data)
+}
+
+func (s *FileTxStore) Get(hash string) (*proto.Transaction, error) {
+	data, ok := s.txx.Get(hash)
+	if !ok {
+		return nil, fmt.Errorf("transaction with hash %s not found", hash)
+	}
+
+	tx := new(proto.Transaction)
+	if err := pb.Unmarshal(data, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (s *FileTxStore) Close() error {
+	return s.txx.Close()
+}
+
+// bestBlockKey is the key of the best block hash in the utxo file. It cannot
+// collide with a utxo key, which always contains an underscore.
+const bestBlockKey = "bestblock"
+
+// FileUTXOStore stores the utxo set and the leaves of its state tree in log
+// structured files
+type FileUTXOStore struct {
+	utxos  *fileKV
+	leaves *fileKV
+}
+
+func NewFileUTXOStore(dir string) (*FileUTXOStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	utxos, err := openFileKV(filepath.Join(dir, "utxos.dat"))
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := openFileKV(filepath.Join(dir, "state.dat"))
+	if err != nil {
+		utxos.Close()
+		return nil, err
+	}
+	return &FileUTXOStore{utxos: utxos, leaves: leaves}, nil
+}
+
+func (s *FileUTXOStore) Put(utxo *UTXO) error {
+	data, err := json.Marshal(utxo)
+	if err != nil {
+		return err
+	}
+	return s.utxos.Put(utxo.Key(), data)
+}
+
+func (s *FileUTXOStore) Get(hash string) (*UTXO, error) {
+	data, ok := s.utxos.Get(hash)
+	if !ok || hash == bestBlockKey {
+		return nil, fmt.Errorf("utxo with hash %s not found", hash)
+	}
+
+	utxo := new(UTXO)
+	if err := json.Unmarshal(data, utxo); err != nil {
+		return nil, err
+	}
+	return utxo, nil
+}
+
+func (s *FileUTXOStore) Delete(hash string) error {
+	return s.utxos.Delete(hash)
+}
+
+func (s *FileUTXOStore) SetBestBlock(hash string) error {
+	return s.utxos.Put(bestBlockKey, []byte(hash))
+}
+
+func (s *FileUTXOStore) BestBlock() (string, error) {
+	data, _ := s.utxos.Get(bestBlockKey)
+	return string(data), nil
+}
+
+func (s *FileUTXOStore) PutStateLeaf(key string, hash []byte) error {
+	return s.leaves.Put(key, hash)
+}
+
+func (s *FileUTXOStore) DeleteStateLeaf(key string) error {
+	return s.leaves.Delete(key)
+}
+
+func (s *FileUTXOStore) StateLeaves() (map[string][]byte, error) {
+	return s.leaves.All(), nil
+}
+
+func (s *FileUTXOStore) Close() error {
+	return errors.Join(s.utxos.Close(), s.leaves.Close())
+}
@@ -0,0 +1,239 @@
+package node
+
+import (
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBlockStore(t *testing.T) {
+	dir := t.TempDir()
+	bs, err := NewFileBlockStore(dir)
+	require.Nil(t, err)
+
+	var blocks []*proto.Block
+	for i := 0; i < 10; i++ {
+		b := signedRandomBlock()
+		require.Nil(t, bs.Put(b))
+		blocks = append(blocks, b)
+	}
+	undo := &BlockUndo{Spent: []*UTXO{{Hash: "abc", OutIndex: 1, Amount: 5, Address: util.RandomHash()[:20]}}}
+	require.Nil(t, bs.PutUndo("abc", undo))
+	require.Nil(t, bs.Close())
+
+	bs, err = NewFileBlockStore(dir)
+	require.Nil(t, err)
+	defer bs.Close()
+
+	for _, b := range blocks {
+		fetched, err := bs.Get(hex.EncodeToString(types.HashBlock(b)))
+		require.Nil(t, err)
+		assert.Equal(t, b.Signature, fetched.Signature)
+		assert.Equal(t, b.Header.PrevHash, fetched.Header.PrevHash)
+	}
+
+	fetchedUndo, err := bs.GetUndo("abc")
+	require.Nil(t, err)
+	assert.Equal(t, undo, fetchedUndo)
+
+	_, err = bs.Get(hex.EncodeToString(util.RandomHash()))
+	assert.NotNil(t, err)
+}
+
+func TestFileBlockStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	bs, err := NewFileBlockStore(dir)
+	require.Nil(t, err)
+
+	b := signedRandomBlock()
+	require.Nil(t, bs.Put(b))
+	require.Nil(t, bs.Close())
+
+	// simulate a crash in the middle of writing the next block
+	f, err := os.OpenFile(filepath.Join(dir, "blk00000.dat"), os.O_APPEND|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, 5})
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	bs, err = NewFileBlockStore(dir)
+	require.Nil(t, err)
+	defer bs.Close()
+
+	next := signedRandomBlock()
+	require.Nil(t, bs.Put(next))
+	for _, block := range []*proto.Block{b, next} {
+		fetched, err := bs.Get(hex.EncodeToString(types.HashBlock(block)))
+		require.Nil(t, err)
+		assert.Equal(t, block.Signature, fetched.Signature)
+	}
+}
+
+func TestRecordLogCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.dat")
+	l, err := openRecordLog(path, 0, nil)
+	require.Nil(t, err)
+	for _, record := range []string{"first", "second", "third"} {
+		_, err := l.Append([]byte(record))
+		require.Nil(t, err)
+	}
+	require.Nil(t, l.Close())
+
+	// flip a byte in the data of the first record, two records follow it
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	data[recordHeaderLen] ^= 0xff
+	require.Nil(t, os.WriteFile(path, data, 0644))
+
+	_, err = openRecordLog(path, 0, nil)
+	assert.ErrorIs(t, err, ErrCorruptRecord)
+
+	// the later records are not cut off
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(data)), info.Size())
+}
+
+func TestFileBlockStoreRebuildsIndex(t *testing.T) {
+	dir := t.TempDir()
+	bs, err := NewFileBlockStore(dir)
+	require.Nil(t, err)
+
+	var blocks []*proto.Block
+	for i := 0; i < 3; i++ {
+		b := signedRandomBlock()
+		require.Nil(t, bs.Put(b))
+		blocks = append(blocks, b)
+	}
+	require.Nil(t, bs.Close())
+
+	// simulate a crash after the last block was written but before it was indexed
+	indexPath := filepath.Join(dir, "index.dat")
+	info, err := os.Stat(indexPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Truncate(indexPath, info.Size()-recordHeaderLen-blockIndexEntryLen))
+
+	bs, err = NewFileBlockStore(dir)
+	require.Nil(t, err)
+	defer bs.Close()
+
+	for _, b := range blocks {
+		_, err := bs.Get(hex.EncodeToString(types.HashBlock(b)))
+		require.Nil(t, err)
+	}
+}
+
+func TestFileUTXOStore(t *testing.T) {
+	dir := t.TempDir()
+	us, err := NewFileUTXOStore(dir)
+	require.Nil(t, err)
+
+	best, err := us.BestBlock()
+	require.Nil(t, err)
+	assert.Equal(t, "", best)
+
+	kept := &UTXO{Hash: "aa", OutIndex: 0, Amount: 10, Address: util.RandomHash()[:20]}
+	spent := &UTXO{Hash: "bb", OutIndex: 1, Amount: 20, Address: util.RandomHash()[:20]}
+	require.Nil(t, us.Put(kept))
+	require.Nil(t, us.Put(spent))
+	require.Nil(t, us.Delete(spent.Key()))
+	require.Nil(t, us.SetBestBlock("cafe"))
+	require.Nil(t, us.Close())
+
+	us, err = NewFileUTXOStore(dir)
+	require.Nil(t, err)
+	defer us.Close()
+
+	fetched, err := us.Get(kept.Key())
+	require.Nil(t, err)
+	assert.Equal(t, kept, fetched)
+	_, err = us.Get(spent.Key())
+	assert.NotNil(t, err)
+
+	best, err = us.BestBlock()
+	require.Nil(t, err)
+	assert.Equal(t, "cafe", best)
+}
+
+func TestFileKVCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.dat")
+	kv, err := openFileKV(path)
+	require.Nil(t, err)
+	for i := 0; i < 2000; i++ {
+		require.Nil(t, kv.Put("key", []byte{byte(i)}))
+	}
+	require.Nil(t, kv.Close())
+
+	before, err := os.Stat(path)
+	require.Nil(t, err)
+
+	kv, err = openFileKV(path)
+	require.Nil(t, err)
+	defer kv.Close()
+
+	after, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	value, ok := kv.Get("key")
+	assert.True(t, ok)
+	assert.Equal(t, []byte{byte(1999 % 256)}, value)
+}
+
+func TestChainReload(t *testing.T) {
+	dir := t.TempDir()
+	open := func() (*Chain, func()) {
+		bs, err := NewFileBlockStore(filepath.Join(dir, "blocks"))
+		require.Nil(t, err)
+		ts, err := NewFileTxStore(dir)
+		require.Nil(t, err)
+		us, err := NewFileUTXOStore(dir)
+		require.Nil(t, err)
+		j, err := NewFileJournal(dir)
+		require.Nil(t, err)
+		chain, err := NewChain(testGenesis(), bs, ts, us, j)
+		require.Nil(t, err)
+		return chain, func() {
+			require.Nil(t, bs.Close())
+			require.Nil(t, ts.Close())
+			require.Nil(t, us.Close())
+		}
+	}
+
+	var (
+		chain, closeChain = open()
+		prvKey            = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient         = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	)
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	require.Nil(t, addTxBlock(t, chain, tx))
+	for i := 0; i < 5; i++ {
+		require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	}
+	tip := chain.Tip()
+	closeChain()
+
+	chain, closeChain = open()
+	defer closeChain()
+
+	assert.Equal(t, 6, chain.Height())
+	assert.Equal(t, tip.Hash, chain.Tip().Hash)
+	assert.Equal(t, tip.Header.StateRoot, chain.StateRoot())
+
+	utxo, err := chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(tx)), 0))
+	require.Nil(t, err)
+	assert.Equal(t, recipient, utxo.Address)
+
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	_, err = chain.disconnectTip()
+	require.Nil(t, err)
+	assert.Equal(t, tip.Hash, chain.Tip().Hash)
+}
@@ -0,0 +1,112 @@
+package node
+
+import (
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"math/big"
+	"sort"
+)
+
+// BlockNode is an entry in the block tree. Every known block has a node, no
+// matter if it is part of the main chain or of a side branch.
+type BlockNode struct {
+	Hash    string
+	Header  *proto.Header
+	Parent  *BlockNode
+	Height  int
+	Work    *big.Int // cumulative work of the chain up to and including this block
+	Invalid bool
+}
+
+// blockWork returns the work a single block adds to its chain, the expected
+// number of hashes needed to mine it. Blocks without proof-of-work count as
+// one unit of work.
+func blockWork(header *proto.Header) *big.Int {
+	if header.Difficulty == 0 {
+		return big.NewInt(1)
+	}
+	return new(big.Int).SetUint64(header.Difficulty)
+}
+
+// Ancestor returns the ancestor of the node at the given height
+func (n *BlockNode) Ancestor(height int) *BlockNode {
+	node := n
+	for node != nil && node.Height > height {
+		node = node.Parent
+	}
+	if node == nil || node.Height != height {
+		return nil
+	}
+	return node
+}
+
+// MedianTime returns the median timestamp of the node and its ancestors, up
+// to count blocks
+func (n *BlockNode) MedianTime(count int) int64 {
+	var timestamps []int64
+	for node := n; node != nil && len(timestamps) < count; node = node.Parent {
+		timestamps = append(timestamps, node.Header.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+type blockIndex struct {
+	nodes map[string]*BlockNode
+}
+
+func newBlockIndex() *blockIndex {
+	return &blockIndex{nodes: make(map[string]*BlockNode)}
+}
+
+// Get returns the node of the block with the given hash
+func (i *blockIndex) Get(hash string) (*BlockNode, bool) {
+	node, ok := i.nodes[hash]
+	return node, ok
+}
+
+// Add adds the block to the index. The parent of the block has to be indexed
+// already, unless the block is the genesis block.
+func (i *blockIndex) Add(block *proto.Block) *BlockNode {
+	hash := hex.EncodeToString(types.HashBlock(block))
+	if node, ok := i.nodes[hash]; ok {
+		return node
+	}
+
+	node := &BlockNode{
+		Hash:   hash,
+		Header: block.Header,
+		Work:   blockWork(block.Header),
+	}
+
+	if parent, ok := i.nodes[hex.EncodeToString(block.Header.PrevHash)]; ok {
+		node.Parent = parent
+		node.Height = parent.Height + 1
+		node.Work.Add(node.Work, parent.Work)
+		node.Invalid = parent.Invalid
+	}
+
+	i.nodes[hash] = node
+	return node
+}
+
+// ForkChoice decides which chain tip the chain follows
+type ForkChoice interface {
+	// Better returns true if candidate should replace current as the chain tip
+	Better(candidate, current *BlockNode) bool
+}
+
+// LongestChain follows the tip with the greatest height
+type LongestChain struct{}
+
+func (LongestChain) Better(candidate, current *BlockNode) bool {
+	return candidate.Height > current.Height
+}
+
+// HeaviestChain follows the tip with the most cumulative work
+type HeaviestChain struct{}
+
+func (HeaviestChain) Better(candidate, current *BlockNode) bool {
+	return candidate.Work.Cmp(current.Work) > 0
+}
@@ -0,0 +1,221 @@
+package node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"os"
+	"time"
+)
+
+// HexBytes is a byte slice written as a hex string in JSON
+type HexBytes []byte
+
+func (b HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+func (b *HexBytes) UnmarshalText(text []byte) error {
+	data, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*b = data
+	return nil
+}
+
+// GenesisAlloc is an amount the genesis block pays to an address, the
+// address is encoded for the network of the genesis
+type GenesisAlloc struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+// Genesis describes the first block of a network. Every node of the network
+// has to start from the same genesis, peers with a different one are refused.
+type Genesis struct {
+	ChainID   string    `json:"chainId"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// AddressHRP is the human readable part of the addresses of the network,
+	// crypto.TestnetHRP if empty
+	AddressHRP string `json:"addressHrp,omitempty"`
+
+	// Validators are the public keys of the initial validator set
+	Validators []HexBytes            `json:"validators"`
+	Consensus  types.ConsensusParams `json:"consensus"`
+	Alloc      []GenesisAlloc        `json:"alloc"`
+}
+
+// LoadGenesis reads and validates the genesis file at the given path.
+// Consensus parameters the file leaves out are set to their defaults.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	genesis := &Genesis{Consensus: types.DefaultConsensusParams()}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(genesis); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGenesis, err)
+	}
+
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+	return genesis, nil
+}
+
+// Save writes the genesis to a file at the given path that LoadGenesis reads
+// back
+func (g *Genesis) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Validate checks that a genesis block can be built from the genesis
+func (g *Genesis) Validate() error {
+	if g.ChainID == "" {
+		return fmt.Errorf("%w: chain id is missing", ErrInvalidGenesis)
+	}
+	if g.Timestamp.IsZero() {
+		return fmt.Errorf("%w: timestamp is missing", ErrInvalidGenesis)
+	}
+	if !crypto.ValidHRP(g.HRP()) {
+		return fmt.Errorf("%w: invalid address hrp %q", ErrInvalidGenesis, g.AddressHRP)
+	}
+
+	for i, validator := range g.Validators {
+		if len(validator) != crypto.PubKeyLen {
+			return fmt.Errorf("%w: validator %d is not a public key", ErrInvalidGenesis, i)
+		}
+	}
+
+	params := g.Consensus
+	if params.BlockTime <= 0 || params.ProposerTimeout <= 0 || params.BlockReward < 0 || params.MaxBlockTxs <= 0 ||
+		params.HalvingInterval < 0 || params.CoinbaseMaturity < 0 || params.EpochLength <= 0 || params.UnbondingPeriod < 0 ||
+		params.MinStake <= 0 || params.MaxValidators <= 0 || params.SlashPercent < 0 || params.SlashPercent > 100 ||
+		params.MaxBlockBytes <= 0 || params.MedianTimeBlocks <= 0 || params.MaxFutureTime <= 0 {
+		return fmt.Errorf("%w: invalid consensus parameters %+v", ErrInvalidGenesis, params)
+	}
+	if params.Engine == consensus.EngineBFT && len(g.Validators) == 0 {
+		return fmt.Errorf("%w: BFT consensus needs validators", ErrInvalidGenesis)
+	}
+
+	if _, err := g.Engine(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidGenesis, err)
+	}
+
+	var total int64
+	for i, alloc := range g.Alloc {
+		if _, err := crypto.ParseAddress(alloc.Address, g.HRP()); err != nil {
+			return fmt.Errorf("%w: alloc %d: %s", ErrInvalidGenesis, i, err)
+		}
+		if alloc.Amount <= 0 {
+			return fmt.Errorf("%w: alloc %d has amount %d", ErrInvalidGenesis, i, alloc.Amount)
+		}
+
+		var err error
+		if total, err = addAmount(total, alloc.Amount); err != nil {
+			return fmt.Errorf("%w: alloc %d: %s", ErrInvalidGenesis, i, err)
+		}
+	}
+
+	return nil
+}
+
+// HRP returns the human readable part of the addresses of the network
+func (g *Genesis) HRP() string {
+	if g.AddressHRP == "" {
+		return crypto.TestnetHRP
+	}
+	return g.AddressHRP
+}
+
+// Engine creates the consensus engine of the network
+func (g *Genesis) Engine() (consensus.Engine, error) {
+	return consensus.New(g.Consensus)
+}
+
+// validators returns the initial validator set
+func (g *Genesis) validators() [][]byte {
+	validators := make([][]byte, len(g.Validators))
+	for i, validator := range g.Validators {
+		validators[i] = validator
+	}
+	return validators
+}
+
+// configHash returns the hash of the parts of the genesis that are not
+// already stored in the genesis block itself.
+func (g *Genesis) configHash() []byte {
+	data, err := json.Marshal(struct {
+		ChainID    string
+		AddressHRP string
+		Validators []HexBytes
+		Consensus  types.ConsensusParams
+	}{g.ChainID, g.HRP(), g.Validators, g.Consensus})
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// Block builds the genesis block. The block has no parent, its PrevHash holds
+// the hash of the genesis configuration instead, so networks with different
+// settings never share a genesis hash. The allocations are paid by a single
+// transaction without inputs. The genesis block is not signed. Block panics
+// on allocations to invalid addresses, Validate rejects them.
+func (g *Genesis) Block() *proto.Block {
+	validatorsHash := types.HashValidators(g.validators())
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:            types.BlockVersion,
+			Height:             0,
+			PrevHash:           g.configHash(),
+			Timestamp:          g.Timestamp.UnixNano(),
+			ValidatorsHash:     validatorsHash,
+			NextValidatorsHash: validatorsHash,
+		},
+	}
+
+	if len(g.Alloc) > 0 {
+		tx := &proto.Transaction{
+			Version: 1,
+			Inputs:  []*proto.TxInput{},
+		}
+		for _, alloc := range g.Alloc {
+			address, err := crypto.ParseAddress(alloc.Address, g.HRP())
+			if err != nil {
+				panic(err)
+			}
+			tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+				Amount:  alloc.Amount,
+				Address: address.Bytes(),
+			})
+		}
+		block.Transactions = append(block.Transactions, tx)
+		block.Header.RootHash = types.GetMerkleTree(block).MerkleRoot()
+	}
+	block.Header.StateRoot = connectState(util.NewSparseMerkleTree(), block).Root()
+
+	return block
+}
+
+// Hash returns the hash of the genesis block
+func (g *Genesis) Hash() []byte {
+	return types.HashBlock(g.Block())
+}
@@ -0,0 +1,137 @@
+package node
+
+import (
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeGenesis(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	require.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadGenesis(t *testing.T) {
+	var (
+		validator = crypto.GeneratePrivateKey().PublicKey().Bytes()
+		address   = crypto.GeneratePrivateKey().PublicKey().Address()
+	)
+
+	path := writeGenesis(t, `{
+		"chainId": "blocker-private",
+		"timestamp": "2023-01-01T00:00:00Z",
+		"addressHrp": "`+crypto.MainnetHRP+`",
+		"validators": ["`+hex.EncodeToString(validator)+`"],
+		"consensus": {"blockReward": 50},
+		"alloc": [{"address": "`+address.Encode(crypto.MainnetHRP)+`", "amount": 500}]
+	}`)
+
+	genesis, err := LoadGenesis(path)
+	require.Nil(t, err)
+	assert.Equal(t, "blocker-private", genesis.ChainID)
+	assert.Equal(t, crypto.MainnetHRP, genesis.HRP())
+	assert.Equal(t, []HexBytes{validator}, genesis.Validators)
+	assert.Equal(t, int64(50), genesis.Consensus.BlockReward)
+	assert.Equal(t, types.DefaultConsensusParams().MaxBlockTxs, genesis.Consensus.MaxBlockTxs)
+
+	again, err := LoadGenesis(path)
+	require.Nil(t, err)
+	assert.Equal(t, genesis.Hash(), again.Hash())
+
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+	assert.Equal(t, genesis.Hash(), chain.GenesisHash())
+
+	tx := genesisTx(t, chain)
+	utxo, err := chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(tx)), 0))
+	require.Nil(t, err)
+	assert.Equal(t, address.Bytes(), utxo.Address)
+	assert.Equal(t, int64(500), utxo.Amount)
+}
+
+func TestLoadGenesisInvalid(t *testing.T) {
+	var (
+		address = crypto.GeneratePrivateKey().PublicKey().Address()
+		typo    = []byte(address.String())
+	)
+	typo[len(typo)-1] ^= 1
+
+	for _, content := range []string{
+		`{"timestamp": "2023-01-01T00:00:00Z"}`,
+		`{"chainId": "c"}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "unknown": 1}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "validators": ["abcd"]}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "consensus": {"blockTime": 0}}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "consensus": {"maxBlockBytes": 0}}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "consensus": {"medianTimeBlocks": 0}}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "addressHrp": "Blk"}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "alloc": [{"address": "abcd", "amount": 1}]}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "alloc": [{"address": "` + hex.EncodeToString(address.Bytes()) + `", "amount": 1}]}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "alloc": [{"address": "` + string(typo) + `", "amount": 1}]}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "alloc": [{"address": "` + address.Encode(crypto.MainnetHRP) + `", "amount": 1}]}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "alloc": [{"address": "` + address.String() + `", "amount": 0}]}`,
+		`{"chainId": "c", "timestamp": "2023-01-01T00:00:00Z", "alloc": [{"address": "` + address.String() + `", "amount": 9223372036854775807}, {"address": "` + address.String() + `", "amount": 1}]}`,
+	} {
+		_, err := LoadGenesis(writeGenesis(t, content))
+		assert.ErrorIs(t, err, ErrInvalidGenesis, content)
+	}
+}
+
+func TestSaveGenesis(t *testing.T) {
+	var (
+		genesis = testGenesis()
+		path    = filepath.Join(t.TempDir(), "genesis.json")
+	)
+	genesis.Validators = []HexBytes{crypto.GeneratePrivateKey().PublicKey().Bytes()}
+	require.Nil(t, genesis.Save(path))
+
+	loaded, err := LoadGenesis(path)
+	require.Nil(t, err)
+	assert.Equal(t, genesis.Hash(), loaded.Hash())
+}
+
+func TestGenesisHash(t *testing.T) {
+	genesis := testGenesis()
+	assert.Equal(t, genesis.Hash(), testGenesis().Hash())
+
+	for _, change := range []func(g *Genesis){
+		func(g *Genesis) { g.ChainID = "other" },
+		func(g *Genesis) { g.Timestamp = g.Timestamp.Add(1) },
+		func(g *Genesis) { g.Consensus.BlockReward++ },
+		func(g *Genesis) { g.Validators = []HexBytes{crypto.GeneratePrivateKey().PublicKey().Bytes()} },
+		func(g *Genesis) { g.Alloc[0].Amount++ },
+		func(g *Genesis) {
+			// the same allocations on another network
+			address, err := crypto.ParseAddress(g.Alloc[0].Address, g.HRP())
+			require.Nil(t, err)
+			g.AddressHRP = crypto.MainnetHRP
+			g.Alloc[0].Address = address.Encode(g.HRP())
+		},
+	} {
+		other := testGenesis()
+		change(other)
+		assert.NotEqual(t, genesis.Hash(), other.Hash())
+	}
+}
+
+func TestChainReloadOtherGenesis(t *testing.T) {
+	var (
+		bs = NewMemoryBlockStore()
+		ts = NewMemoryTxStore()
+		us = NewMemoryUTXOStore()
+		j  = NewMemoryJournal()
+	)
+	_, err := NewChain(testGenesis(), bs, ts, us, j)
+	require.Nil(t, err)
+
+	other := testGenesis()
+	other.ChainID = "other"
+	_, err = NewChain(other, bs, ts, us, j)
+	assert.ErrorIs(t, err, ErrGenesisMismatch)
+}
@@ -1,9 +1,12 @@
 package node
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
 	"github.com/fzft/crypto-prd-blockchain/crypto"
 	"github.com/fzft/crypto-prd-blockchain/proto"
 	"github.com/fzft/crypto-prd-blockchain/types"
@@ -13,10 +16,12 @@ import (
 	"google.golang.org/grpc/peer"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const blockInterval = 5 * time.Second
+// slotCheckInterval is how often a validator checks if its slot came up
+const slotCheckInterval = 250 * time.Millisecond
 
 type MemPool struct {
 	txx *util.KeyValueStore[string, *proto.Transaction]
@@ -40,6 +45,12 @@ func (m *MemPool) Add(tx *proto.Transaction) bool {
 	return m.txx.HasOrAdd(hash, tx)
 }
 
+// Remove removes a transaction from the mempool.
+func (m *MemPool) Remove(tx *proto.Transaction) {
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	m.txx.Delete(hash)
+}
+
 // Len returns the number of transactions in the mempool.
 func (m *MemPool) Len() int {
 	return m.txx.Len()
@@ -54,6 +65,11 @@ type ServerConfig struct {
 	Version    string
 	ListenAddr string
 	PrivateKey *crypto.PrivateKey
+
+	// Chain is the chain the node follows. New creates a chain of the
+	// network described by Genesis backed by memory stores if it is not set.
+	Chain   *Chain
+	Genesis *Genesis
 }
 
 type Node struct {
@@ -65,19 +81,55 @@ type Node struct {
 
 	mempool *MemPool
 
+	// evidence holds the evidence of double signing for the next block
+	evidence *EvidencePool
+
+	// seenBlocks holds the hashes of the blocks already handled, so every
+	// block is validated and relayed only once
+	seenBlocks *util.KeyValueStore[string, bool]
+
+	// syncing is set while the node downloads blocks from its peers
+	syncing atomic.Bool
+
+	// sealStop is closed to abort sealing once the block being sealed no
+	// longer extends the tip
+	sealLock sync.Mutex
+	sealStop chan struct{}
+
+	// bft runs the BFT protocol if the node has a key on a BFT network
+	bft *bftState
+
 	proto.UnimplementedNodeServer
 }
 
 func New(cfg ServerConfig) *Node {
+	if cfg.Chain == nil {
+		chain, err := NewChain(cfg.Genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+		if err != nil {
+			panic(err)
+		}
+		cfg.Chain = chain
+	}
+
 	loggerConfig := zap.NewDevelopmentConfig()
 	loggerConfig.EncoderConfig.TimeKey = ""
 	logger, _ := loggerConfig.Build()
-	return &Node{
+	n := &Node{
 		peers:        make(map[proto.NodeClient]*proto.Version),
 		logger:       logger.Sugar(),
 		mempool:      NewMemPool(),
+		evidence:     NewEvidencePool(),
+		seenBlocks:   util.NewKeyValueStore[string, bool](),
 		ServerConfig: cfg,
 	}
+	n.Chain.Subscribe(n.onChainEvent)
+
+	// the validator set changes every epoch, so every node with a key
+	// follows the protocol and only votes while it is in the set
+	if engine, ok := n.Chain.Engine().(*consensus.BFT); ok && cfg.PrivateKey != nil {
+		n.bft = newBFTState(n, engine, n.gossip)
+	}
+	return n
 }
 
 // Start ...
@@ -102,15 +154,22 @@ func (n *Node) Start(listenAddr string, bootstrapNodes ...string) error {
 		go n.bootstrapNetwork(bootstrapNodes...)
 	}
 
-	if n.PrivateKey != nil {
+	if n.bft != nil {
+		go n.bftLoop()
+	} else if n.PrivateKey != nil {
 		go n.validatorLoop()
 	}
 
 	return grpcServer.Serve(ln)
 }
 
-// Handshake is called when a new peer connects to the node.
+// Handshake is called when a new peer connects to the node. Peers of another
+// network, with a different genesis block, are refused.
 func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version, error) {
+	if err := n.checkGenesis(v); err != nil {
+		return nil, err
+	}
+
 	c, err := makeNodeClient(v.ListenAddr)
 	if err != nil {
 		return nil, err
@@ -120,13 +179,20 @@ func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version,
 	return n.getVersion(), nil
 }
 
+// HandleTransaction is called when a peer relays a transaction. Transactions
+// that are valid against our chain are added to the mempool and relayed.
 func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*proto.Ack, error) {
-
-	peer, _ := peer.FromContext(ctx)
 	hash := hex.EncodeToString(types.HashTransaction(tx))
+	if n.mempool.Has(tx) {
+		return &proto.Ack{}, nil
+	}
+
+	if err := n.Chain.ValidateTransaction(tx); err != nil {
+		return nil, err
+	}
 
 	if n.mempool.Add(tx) {
-		n.logger.Debugw("received transaction", "from", peer.Addr.String(), "hash", hash, "we", n.ListenAddr)
+		n.logger.Debugw("received transaction", "from", peerAddr(ctx), "hash", hash, "we", n.ListenAddr)
 		go func() {
 			if err := n.broadcast(tx); err != nil {
 				n.logger.Errorf("Error broadcasting transaction - %s", err)
@@ -137,29 +203,300 @@ func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*p
 	return &proto.Ack{}, nil
 }
 
-// validatorLoop
+// HandleBlock is called when a peer relays a block. Valid blocks are added to
+// the chain and relayed to the other peers.
+func (n *Node) HandleBlock(ctx context.Context, block *proto.Block) (*proto.Ack, error) {
+	hash := hex.EncodeToString(types.HashBlock(block))
+	if n.seenBlocks.Has(hash) {
+		return &proto.Ack{}, nil
+	}
+
+	err := n.Chain.AddBlock(block)
+	if err == nil || errors.Is(err, ErrConflictsWithCommit) {
+		// a validator may sign a block conflicting with a committed one,
+		// which is refused but still proof of double signing
+		n.checkDoubleSign(block)
+	}
+	if err != nil {
+		if errors.Is(err, ErrKnownBlock) {
+			n.seenBlocks.Put(hash, true)
+			return &proto.Ack{}, nil
+		}
+		if errors.Is(err, ErrOrphanBlock) {
+			// we are missing blocks, the block may become valid once they
+			// are synced
+			go n.syncWithPeers(int(block.Header.Height))
+		}
+		if !isTemporaryBlockError(err) {
+			n.seenBlocks.Put(hash, true)
+		}
+		return nil, err
+	}
+	n.seenBlocks.Put(hash, true)
+
+	n.logger.Debugw("received block", "from", peerAddr(ctx), "hash", hash, "height", block.Header.Height, "we", n.ListenAddr)
+
+	go func() {
+		if err := n.broadcast(block); err != nil {
+			n.logger.Errorf("Error broadcasting block - %s", err)
+		}
+	}()
+
+	return &proto.Ack{}, nil
+}
+
+// isTemporaryBlockError returns true if a block refused with the error may be
+// accepted when it arrives again, once its parent is known or its timestamp
+// is no longer in the future
+func isTemporaryBlockError(err error) bool {
+	return errors.Is(err, ErrOrphanBlock) || errors.Is(err, ErrTimeTooNew) || errors.Is(err, consensus.ErrFutureBlock)
+}
+
+// HandleProposal is called when a validator relays a proposal of the BFT
+// protocol. Nodes that are not validators ignore it.
+func (n *Node) HandleProposal(ctx context.Context, proposal *proto.Proposal) (*proto.Ack, error) {
+	if n.bft == nil {
+		return &proto.Ack{}, nil
+	}
+
+	added, err := n.bft.handleProposal(proposal, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		n.gossip(proposal)
+	}
+	return &proto.Ack{}, nil
+}
+
+// HandleVote is called when a validator relays a prevote or precommit.
+// Nodes that are not validators ignore it.
+func (n *Node) HandleVote(ctx context.Context, vote *proto.Vote) (*proto.Ack, error) {
+	if n.bft == nil {
+		return &proto.Ack{}, nil
+	}
+
+	added, err := n.bft.handleVote(vote, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		n.gossip(vote)
+	}
+	return &proto.Ack{}, nil
+}
+
+// HandleCommit is called when a peer relays the commit certificate of a
+// block. New certificates are recorded and relayed.
+func (n *Node) HandleCommit(ctx context.Context, cert *proto.CommitCertificate) (*proto.Ack, error) {
+	if int(cert.Height) <= n.Chain.Committed().Height {
+		return &proto.Ack{}, nil
+	}
+
+	if err := n.Chain.CommitBlock(cert); err != nil {
+		return nil, err
+	}
+	n.logger.Debugw("received commit", "from", peerAddr(ctx), "height", cert.Height, "we", n.ListenAddr)
+	n.gossip(cert)
+	return &proto.Ack{}, nil
+}
+
+// HandleEvidence is called when a peer relays evidence of double signing.
+// Valid new evidence is kept for the next block and relayed.
+func (n *Node) HandleEvidence(ctx context.Context, evidence *proto.Evidence) (*proto.Ack, error) {
+	if n.evidence.Has(evidence) {
+		return &proto.Ack{}, nil
+	}
+
+	if err := n.Chain.ValidateEvidence(evidence); err != nil {
+		return nil, err
+	}
+	if n.evidence.Add(evidence) {
+		n.logger.Debugw("received evidence", "from", peerAddr(ctx), "offender", hex.EncodeToString(evidence.PublicKey), "height", evidence.HeaderA.Height, "we", n.ListenAddr)
+		n.gossip(evidence)
+	}
+	return &proto.Ack{}, nil
+}
+
+// checkDoubleSign records the block and reports its producer to the network
+// if it signed another block at the same height.
+func (n *Node) checkDoubleSign(block *proto.Block) {
+	if !types.VerifyBlock(block) {
+		return
+	}
+	evidence := n.evidence.CheckBlock(block)
+	if evidence == nil {
+		return
+	}
+
+	if err := n.Chain.ValidateEvidence(evidence); err != nil {
+		n.logger.Debugw("ignoring double signing", "offender", hex.EncodeToString(evidence.PublicKey), "err", err)
+		return
+	}
+	if n.evidence.Add(evidence) {
+		n.logger.Warnw("validator signed two blocks", "offender", hex.EncodeToString(evidence.PublicKey), "height", block.Header.Height)
+		n.gossip(evidence)
+	}
+}
+
+// onChainEvent keeps the mempool and the evidence pool in line with the main
+// chain
+func (n *Node) onChainEvent(event ChainEvent) {
+	n.abortSeal()
+	for _, tx := range event.Block.Transactions {
+		switch event.Type {
+		case BlockConnected:
+			n.mempool.Remove(tx)
+		case BlockDisconnected:
+			if !types.IsCoinbaseTx(tx) {
+				n.mempool.Add(tx)
+			}
+		}
+	}
+
+	for _, evidence := range event.Block.Evidence {
+		switch event.Type {
+		case BlockConnected:
+			n.evidence.Remove(evidence)
+		case BlockDisconnected:
+			n.evidence.Add(evidence)
+		}
+	}
+	if event.Type == BlockConnected {
+		n.evidence.Prune(int(event.Block.Header.Height) - n.Chain.Params().UnbondingPeriod)
+	}
+}
+
+// validatorLoop produces a block whenever the slot of the node comes up
 func (n *Node) validatorLoop() {
-	n.logger.Infow("Starting validator loop", "pubkey", n.PrivateKey.PublicKey().Address(), "blockTime", blockInterval)
-	ticker := time.NewTicker(blockInterval)
+	pubKey := n.PrivateKey.PublicKey().Bytes()
+	n.logger.Infow("Starting validator loop", "address", n.PrivateKey.PublicKey().Address().Encode(n.Chain.HRP()), "blockTime", n.Chain.Params().BlockInterval())
+	ticker := time.NewTicker(slotCheckInterval)
 	for {
 		<-ticker.C
-		txx := n.mempool.Clear()
-		n.logger.Debugw("time to create new block", "lenTx", len(txx))
+		// never produce faster than the block interval
+		since := time.Since(time.Unix(0, n.Chain.Tip().Header.Timestamp))
+		if since < n.Chain.Params().BlockInterval() || !n.Chain.CanPropose(pubKey, time.Now()) {
+			continue
+		}
+
+		block, err := n.produceBlock()
+		if err != nil {
+			n.logger.Errorf("Error producing block - %s", err)
+			continue
+		}
+		n.logger.Debugw("produced block", "height", block.Header.Height, "lenTx", len(block.Transactions))
+
+		n.seenBlocks.Put(hex.EncodeToString(types.HashBlock(block)), true)
+		go func() {
+			if err := n.broadcast(block); err != nil {
+				n.logger.Errorf("Error broadcasting block - %s", err)
+			}
+		}()
+	}
+}
+
+// bftLoop drives the BFT protocol, moving on whenever a step times out
+func (n *Node) bftLoop() {
+	n.logger.Infow("Starting BFT validator", "address", n.PrivateKey.PublicKey().Address().Encode(n.Chain.HRP()))
+	ticker := time.NewTicker(slotCheckInterval)
+	for {
+		<-ticker.C
+		n.bft.tick(time.Now())
+	}
+}
+
+// produceBlock builds a block from the mempool on top of the chain tip, seals
+// it with the consensus engine and adds it to the chain. Transactions that are
+// not part of the block go back to the mempool.
+func (n *Node) produceBlock() (*proto.Block, error) {
+	txx := n.mempool.Clear()
+	block, leftover, err := n.Chain.BuildBlock(n.PrivateKey.PublicKey(), txx, n.evidence.Pending(), time.Now())
+	for _, tx := range leftover {
+		n.mempool.Add(tx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stop := n.startSeal()
+	err = n.Chain.Engine().Seal(n.Chain, block, n.PrivateKey, stop)
+	n.abortSeal()
+	if err != nil {
+		for _, tx := range block.Transactions[1:] {
+			n.mempool.Add(tx)
+		}
+		return nil, err
+	}
+	if err := n.Chain.AddBlock(block); err != nil {
+		// the coinbase is not a mempool transaction
+		for _, tx := range block.Transactions[1:] {
+			n.mempool.Add(tx)
+		}
+		return nil, err
 	}
+
+	return block, nil
+}
+
+// startSeal returns the channel that is closed when sealing has to stop
+func (n *Node) startSeal() <-chan struct{} {
+	n.sealLock.Lock()
+	defer n.sealLock.Unlock()
+	n.sealStop = make(chan struct{})
+	return n.sealStop
 }
 
-// broadcast
+// abortSeal stops sealing, if a block is being sealed
+func (n *Node) abortSeal() {
+	n.sealLock.Lock()
+	defer n.sealLock.Unlock()
+	if n.sealStop != nil {
+		close(n.sealStop)
+		n.sealStop = nil
+	}
+}
+
+// gossip broadcasts the message in the background
+func (n *Node) gossip(msg any) {
+	go func() {
+		if err := n.broadcast(msg); err != nil {
+			n.logger.Errorf("Error broadcasting %T - %s", msg, err)
+		}
+	}()
+}
+
+// broadcast sends the message to every peer. A peer that refuses the
+// message does not keep it from the others, its error is only logged.
 func (n *Node) broadcast(msg any) error {
-	for peer := range n.peers {
+	n.peerLock.RLock()
+	peers := make(map[proto.NodeClient]*proto.Version, len(n.peers))
+	for peer, version := range n.peers {
+		peers[peer] = version
+	}
+	n.peerLock.RUnlock()
+
+	for peer, version := range peers {
+		var err error
 		switch v := msg.(type) {
 		case *proto.Transaction:
-			if _, err := peer.HandleTransaction(context.Background(), v); err != nil {
-				return err
-			}
+			_, err = peer.HandleTransaction(context.Background(), v)
+		case *proto.Block:
+			_, err = peer.HandleBlock(context.Background(), v)
+		case *proto.Proposal:
+			_, err = peer.HandleProposal(context.Background(), v)
+		case *proto.Vote:
+			_, err = peer.HandleVote(context.Background(), v)
+		case *proto.CommitCertificate:
+			_, err = peer.HandleCommit(context.Background(), v)
+		case *proto.Evidence:
+			_, err = peer.HandleEvidence(context.Background(), v)
 		default:
 			return fmt.Errorf("unknown message type %T", v)
 		}
-
+		if err != nil {
+			n.logger.Debugw("peer refused message", "peer", version.ListenAddr, "type", fmt.Sprintf("%T", msg), "err", err)
+		}
 	}
 	return nil
 }
@@ -191,6 +528,14 @@ func (n *Node) addPeer(peer proto.NodeClient, version *proto.Version) {
 		go n.bootstrapNetwork(version.PeerList...)
 	}
 
+	if int(version.Height) > n.Chain.Height() {
+		go func() {
+			if err := n.syncWith(peer, int(version.Height)); err != nil {
+				n.logger.Errorf("Error syncing with (%s) - %s", version.ListenAddr, err)
+			}
+		}()
+	}
+
 	n.logger.Infof("(%s) Adding peer (%s) - height(%d)", n.ListenAddr, version.ListenAddr, version.Height)
 
 }
@@ -211,16 +556,37 @@ func makeNodeClient(listenAddr string) (proto.NodeClient, error) {
 	return proto.NewNodeClient(c), nil
 }
 
+// peerAddr returns the address of the peer that made the call
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	return p.Addr.String()
+}
+
 // getVersion is the version of the node.
 func (n *Node) getVersion() *proto.Version {
+	tip := n.Chain.Tip()
+	tipHash, _ := hex.DecodeString(tip.Hash)
 	return &proto.Version{
-		Version:    "blocker-0.1",
-		Height:     0,
-		ListenAddr: n.ListenAddr,
-		PeerList:   n.getPeerList(),
+		Version:     "blocker-0.1",
+		Height:      int32(tip.Height),
+		ListenAddr:  n.ListenAddr,
+		PeerList:    n.getPeerList(),
+		TipHash:     tipHash,
+		GenesisHash: n.Chain.GenesisHash(),
 	}
 }
 
+// checkGenesis returns an error if the peer follows a different genesis block
+func (n *Node) checkGenesis(v *proto.Version) error {
+	if !bytes.Equal(v.GenesisHash, n.Chain.GenesisHash()) {
+		return fmt.Errorf("%w: peer (%s) has genesis %x", ErrGenesisMismatch, v.ListenAddr, v.GenesisHash)
+	}
+	return nil
+}
+
 // canConnectWith returns true if the node can connect with the other node.
 func (n *Node) canConnectWith(addr string) bool {
 	if n.ListenAddr == addr {
@@ -258,5 +624,8 @@ func (n *Node) dialRemoteNode(addr string) (proto.NodeClient, *proto.Version, er
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := n.checkGenesis(v); err != nil {
+		return nil, nil, err
+	}
 	return c, v, nil
 }
@@ -0,0 +1,172 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"testing"
+	"time"
+)
+
+func TestProduceBlock(t *testing.T) {
+	var (
+		n         = New(ServerConfig{PrivateKey: crypto.GeneratePrivateKey(), Genesis: testGenesis()})
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		prevTx    = genesisTx(t, n.Chain)
+	)
+
+	valid := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: prvKey.PublicKey().Address().Bytes()})
+	orphan := spendTx(prvKey, valid, 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	n.mempool.Add(orphan)
+	n.mempool.Add(valid)
+
+	block, err := n.produceBlock()
+	require.Nil(t, err)
+	assert.Equal(t, 1, n.Chain.Height())
+	assert.True(t, types.VerifyBlock(block))
+	assert.Equal(t, n.PrivateKey.PublicKey().Bytes(), block.PublicKey)
+	assert.True(t, types.IsCoinbaseTx(block.Transactions[0]))
+
+	// the mempool is drained in random order, so the orphan is either included
+	// after its parent or handed back to the mempool
+	if len(block.Transactions) == 2 {
+		assert.True(t, n.mempool.Has(orphan))
+		assert.Equal(t, 1, n.mempool.Len())
+
+		block, err = n.produceBlock()
+		require.Nil(t, err)
+	}
+	assert.Equal(t, 0, n.mempool.Len())
+	assert.Equal(t, orphan, block.Transactions[len(block.Transactions)-1])
+}
+
+func TestHandleBlock(t *testing.T) {
+	var (
+		validator = New(ServerConfig{PrivateKey: crypto.GeneratePrivateKey(), Genesis: testGenesis()})
+		n         = New(ServerConfig{Genesis: testGenesis()})
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	)
+
+	tx := spendTx(prvKey, genesisTx(t, n.Chain), 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	validator.mempool.Add(tx)
+	n.mempool.Add(tx)
+
+	block, err := validator.produceBlock()
+	require.Nil(t, err)
+
+	_, err = n.HandleBlock(context.Background(), block)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n.Chain.Height())
+	assert.False(t, n.mempool.Has(tx))
+
+	// a block is only handled once
+	_, err = n.HandleBlock(context.Background(), block)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n.Chain.Height())
+
+	invalid := childBlock(n.Chain, block)
+	invalid.Signature = block.Signature
+	_, err = n.HandleBlock(context.Background(), invalid)
+	assert.ErrorIs(t, err, ErrInvalidBlock)
+
+	// an invalid block is only handled once, a block that is early is
+	// handled again when it arrives again
+	_, err = n.HandleBlock(context.Background(), invalid)
+	assert.Nil(t, err)
+
+	early := childBlock(n.Chain, block)
+	early.Header.Timestamp = time.Now().Add(time.Hour).UnixNano()
+	signBlock(n.Chain, crypto.GeneratePrivateKey(), early)
+	for i := 0; i < 2; i++ {
+		_, err = n.HandleBlock(context.Background(), early)
+		assert.ErrorIs(t, err, ErrTimeTooNew)
+	}
+}
+
+func TestHandleTransaction(t *testing.T) {
+	var (
+		n         = New(ServerConfig{Genesis: testGenesis()})
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		prevTx    = genesisTx(t, n.Chain)
+	)
+
+	tx := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	_, err := n.HandleTransaction(context.Background(), tx)
+	require.Nil(t, err)
+	assert.True(t, n.mempool.Has(tx))
+
+	overspend := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1001, Address: recipient})
+	_, err = n.HandleTransaction(context.Background(), overspend)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	assert.False(t, n.mempool.Has(overspend))
+}
+
+// recordingPeer is a peer that records the transactions it is sent and
+// refuses them if err is set
+type recordingPeer struct {
+	proto.NodeClient
+	err error
+	txx chan *proto.Transaction
+}
+
+func (p *recordingPeer) HandleTransaction(_ context.Context, tx *proto.Transaction, _ ...grpc.CallOption) (*proto.Ack, error) {
+	p.txx <- tx
+	return &proto.Ack{}, p.err
+}
+
+func TestBroadcastFailingPeer(t *testing.T) {
+	n := New(ServerConfig{Genesis: testGenesis()})
+	peers := []*recordingPeer{
+		{err: ErrInsufficientFunds, txx: make(chan *proto.Transaction, 1)},
+		{txx: make(chan *proto.Transaction, 1)},
+		{txx: make(chan *proto.Transaction, 1)},
+	}
+	for i, peer := range peers {
+		n.peers[peer] = &proto.Version{ListenAddr: fmt.Sprintf(":%d", 4000+i)}
+	}
+
+	// the peers after the one refusing the transaction still receive it
+	tx := spendTx(crypto.GeneratePrivateKeyFromSeedStr(godSeed), genesisTx(t, n.Chain), 0)
+	require.Nil(t, n.broadcast(tx))
+	for _, peer := range peers {
+		assert.Equal(t, tx, <-peer.txx)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	chain := newTestChain(t)
+	for i := 0; i < 3; i++ {
+		require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	}
+
+	n := New(ServerConfig{Chain: chain})
+	tip, err := chain.GetBlockByHeight(3)
+	require.Nil(t, err)
+
+	v := n.getVersion()
+	assert.Equal(t, int32(3), v.Height)
+	assert.Equal(t, types.HashBlock(tip), v.TipHash)
+	assert.Equal(t, chain.GenesisHash(), v.GenesisHash)
+}
+
+func TestHandshakeGenesisMismatch(t *testing.T) {
+	other := testGenesis()
+	other.ChainID = "other"
+
+	var (
+		n    = New(ServerConfig{Genesis: testGenesis()})
+		peer = New(ServerConfig{Genesis: other})
+	)
+
+	_, err := n.Handshake(context.Background(), peer.getVersion())
+	assert.ErrorIs(t, err, ErrGenesisMismatch)
+	assert.Empty(t, n.getPeerList())
+}
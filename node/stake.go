@@ -0,0 +1,244 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"sort"
+)
+
+// stakeDelta returns how the transactions of a block that spent the given
+// outputs change the bonded stake of every validator.
+func stakeDelta(txx []*proto.Transaction, spent []*UTXO) map[string]int64 {
+	delta := make(map[string]int64)
+	for _, tx := range txx {
+		if tx.Type != proto.TxType_BOND {
+			continue
+		}
+		for _, output := range tx.Outputs {
+			if len(output.Validator) > 0 {
+				delta[hex.EncodeToString(output.Validator)] += output.Amount
+			}
+		}
+	}
+	for _, utxo := range spent {
+		if utxo.Bonded() {
+			delta[hex.EncodeToString(utxo.Validator)] -= utxo.Amount
+		}
+	}
+	return delta
+}
+
+// addStake returns a copy of the stake with sign times the delta added.
+// Validators without stake are dropped.
+func addStake(stake, delta map[string]int64, sign int64) map[string]int64 {
+	result := make(map[string]int64, len(stake))
+	for validator, amount := range stake {
+		result[validator] = amount
+	}
+	for validator, amount := range delta {
+		result[validator] += sign * amount
+		if result[validator] == 0 {
+			delete(result, validator)
+		}
+	}
+	return result
+}
+
+// jailedBy returns a copy of the jailed validators with the offenders of the
+// evidence jailed at the given height.
+func jailedBy(jailed map[string]int, evidence []*proto.Evidence, height int) map[string]int {
+	result := make(map[string]int, len(jailed)+len(evidence))
+	for validator, at := range jailed {
+		result[validator] = at
+	}
+	for _, e := range evidence {
+		result[hex.EncodeToString(e.PublicKey)] = height
+	}
+	return result
+}
+
+// slashed returns true if spending the output burns the slashed part of its
+// amount: it is bonded to a jailed validator, or its validator was jailed
+// while it was locked by the unbonding. Stake unbonded after the jailing was
+// slashed by the unbond already.
+func (c *Chain) slashed(utxo *UTXO, jailed map[string]int) bool {
+	if len(utxo.Validator) == 0 {
+		return false
+	}
+	at, ok := jailed[hex.EncodeToString(utxo.Validator)]
+	if !ok || utxo.Bonded() {
+		return ok
+	}
+	return at > utxo.Height && at < utxo.Height+c.genesis.Consensus.UnbondingPeriod
+}
+
+// withoutJailed returns the set without the validators jailed at or below the
+// given height. A set is never emptied, the chain has to go on.
+func withoutJailed(validators [][]byte, jailed map[string]int, height int) [][]byte {
+	var result [][]byte
+	for _, validator := range validators {
+		if at, ok := jailed[hex.EncodeToString(validator)]; !ok || at > height {
+			result = append(result, validator)
+		}
+	}
+	if len(result) == 0 {
+		return validators
+	}
+	return result
+}
+
+// electValidators elects a validator set from the bonded stake: the
+// validators with at least the minimum stake that are not jailed, most stake
+// first and ties broken by public key, up to the maximum set size. If nobody
+// qualifies, the current set stays in office.
+func (c *Chain) electValidators(stake map[string]int64, jailed map[string]int, current [][]byte) [][]byte {
+	params := c.genesis.Consensus
+
+	var candidates []string
+	for validator, amount := range stake {
+		if _, ok := jailed[validator]; ok {
+			continue
+		}
+		if amount >= params.MinStake {
+			candidates = append(candidates, validator)
+		}
+	}
+	if len(candidates) == 0 {
+		return current
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if stake[candidates[i]] != stake[candidates[j]] {
+			return stake[candidates[i]] > stake[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+	if len(candidates) > params.MaxValidators {
+		candidates = candidates[:params.MaxValidators]
+	}
+
+	validators := make([][]byte, len(candidates))
+	for i, candidate := range candidates {
+		validators[i], _ = hex.DecodeString(candidate)
+	}
+	return validators
+}
+
+// validators returns the validator set of the block following parent, the
+// set elected after the last epoch boundary at or before parent without the
+// validators jailed up to parent.
+func (c *Chain) validators(parent *proto.Header) [][]byte {
+	return withoutJailed(c.electedValidators(parent), c.jailed, int(parent.Height))
+}
+
+// electedValidators returns the set elected after the last epoch boundary at
+// or before parent. A boundary block on a side branch has no set until its
+// branch is connected, until then the set of the boundary before it is used.
+func (c *Chain) electedValidators(parent *proto.Header) [][]byte {
+	node, ok := c.index.Get(hex.EncodeToString(types.HashHeader(parent)))
+	if !ok {
+		return c.genesis.validators()
+	}
+
+	epoch := c.genesis.Consensus.EpochLength
+	for height := node.Height / epoch * epoch; height >= 0; height -= epoch {
+		if validators, ok := c.validatorSets[node.Ancestor(height).Hash]; ok {
+			return validators
+		}
+	}
+	return c.genesis.validators()
+}
+
+// blockValidators returns the validator set of a block on top of the tip,
+// which spent the given outputs, and the set of the block after it. The
+// offenders of the evidence in the block are left out of the next set.
+func (c *Chain) blockValidators(block *proto.Block, spent []*UTXO) ([][]byte, [][]byte) {
+	var (
+		height = c.tip.Height + 1
+		jailed = jailedBy(c.jailed, block.Evidence, height)
+		next   = c.electedValidators(c.tip.Header)
+	)
+	if height%c.genesis.Consensus.EpochLength == 0 {
+		next = c.electValidators(addStake(c.stake, stakeDelta(block.Transactions, spent), 1), jailed, next)
+	}
+	return c.validators(c.tip.Header), withoutJailed(next, jailed, height)
+}
+
+// verifyValidators checks the validator set hashes in the header of a block
+// on top of the tip.
+func (c *Chain) verifyValidators(block *proto.Block, spent []*UTXO) error {
+	var (
+		header           = block.Header
+		validators, next = c.blockValidators(block, spent)
+	)
+	if !bytes.Equal(header.ValidatorsHash, types.HashValidators(validators)) {
+		return fmt.Errorf("%w: validator set hash does not match", ErrInvalidBlock)
+	}
+	if !bytes.Equal(header.NextValidatorsHash, types.HashValidators(next)) {
+		return fmt.Errorf("%w: next validator set hash does not match", ErrInvalidBlock)
+	}
+	return nil
+}
+
+// connectStake applies the stake changes of a block connected to the main
+// chain, jails the offenders of its evidence and elects the next validator
+// set if the block ends an epoch.
+func (c *Chain) connectStake(node *BlockNode, block *proto.Block, spent []*UTXO) {
+	current := c.genesis.validators()
+	if node.Parent != nil {
+		current = c.electedValidators(node.Parent.Header)
+	}
+
+	c.stake = addStake(c.stake, stakeDelta(block.Transactions, spent), 1)
+	c.jailed = jailedBy(c.jailed, block.Evidence, node.Height)
+	if node.Height%c.genesis.Consensus.EpochLength == 0 {
+		c.validatorSets[node.Hash] = c.electValidators(c.stake, c.jailed, current)
+	}
+}
+
+// disconnectStake reverts the stake changes and releases the offenders jailed
+// by a block disconnected from the main chain. The validator set elected
+// after the block is kept, it stays valid for the block.
+func (c *Chain) disconnectStake(block *proto.Block, spent []*UTXO) {
+	c.stake = addStake(c.stake, stakeDelta(block.Transactions, spent), -1)
+	for _, evidence := range block.Evidence {
+		delete(c.jailed, hex.EncodeToString(evidence.PublicKey))
+	}
+}
+
+// validateEvidence checks that the evidence proves a validator of the chain
+// signed two blocks at the same height recently enough to be punished in the
+// block at the given height.
+func (c *Chain) validateEvidence(evidence *proto.Evidence, height int) error {
+	if c.genesis.Consensus.Engine == consensus.EnginePoW {
+		return fmt.Errorf("%w: miners may produce competing blocks", ErrInvalidEvidence)
+	}
+	if !types.VerifyEvidence(evidence) {
+		return fmt.Errorf("%w: headers do not prove double signing", ErrInvalidEvidence)
+	}
+
+	offense := int(evidence.HeaderA.Height)
+	if offense >= height {
+		return fmt.Errorf("%w: double signing at height %d is not in the past", ErrInvalidEvidence, offense)
+	}
+	// after the unbonding period the stake may be gone
+	if height-offense > c.genesis.Consensus.UnbondingPeriod {
+		return fmt.Errorf("%w: double signing at height %d expired", ErrInvalidEvidence, offense)
+	}
+	if _, ok := c.jailed[hex.EncodeToString(evidence.PublicKey)]; ok {
+		return fmt.Errorf("%w: %x is jailed already", ErrInvalidEvidence, evidence.PublicKey)
+	}
+
+	parent, ok := c.index.Get(hex.EncodeToString(evidence.HeaderA.PrevHash))
+	if !ok {
+		return fmt.Errorf("%w: parent of the signed block is unknown", ErrInvalidEvidence)
+	}
+	if !consensus.IsValidator(c.validators(parent.Header), evidence.PublicKey) {
+		return fmt.Errorf("%w: %x is not a validator at height %d", ErrInvalidEvidence, evidence.PublicKey, offense)
+	}
+	return nil
+}
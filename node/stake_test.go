@@ -0,0 +1,149 @@
+package node
+
+import (
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// stakeGenesis returns the test genesis with short epochs and a short
+// unbonding period
+func stakeGenesis() *Genesis {
+	genesis := testGenesis()
+	genesis.Consensus.EpochLength = 2
+	genesis.Consensus.UnbondingPeriod = 3
+	genesis.Consensus.MinStake = 100
+	genesis.Consensus.MaxValidators = 2
+	return genesis
+}
+
+// typedTx spends output outIndex of prevTx with the given key in a
+// transaction of the given type.
+func typedTx(prvKey *crypto.PrivateKey, typ proto.TxType, prevTx *proto.Transaction, outIndex uint32, outputs ...*proto.TxOutput) *proto.Transaction {
+	tx := spendTx(prvKey, prevTx, outIndex, outputs...)
+	tx.Type = typ
+	if err := types.SignTransaction(prvKey, tx); err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+func TestStakeElectsValidators(t *testing.T) {
+	var (
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+		a      = crypto.GeneratePrivateKey().PublicKey().Bytes()
+		b      = crypto.GeneratePrivateKey().PublicKey().Bytes()
+		c      = crypto.GeneratePrivateKey().PublicKey().Bytes()
+	)
+	chain, err := NewChain(stakeGenesis(), NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+	assert.Empty(t, chain.Validators(chain.Tip().Header))
+
+	bond := typedTx(prvKey, proto.TxType_BOND, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 200, Address: addr, Validator: a},
+		&proto.TxOutput{Amount: 300, Address: addr, Validator: b},
+		&proto.TxOutput{Amount: 50, Address: addr, Validator: c},
+		&proto.TxOutput{Amount: 450, Address: addr},
+	)
+	buildBlock(t, chain, nil, nil, bond)
+	assert.Equal(t, int64(200), chain.Stake(a))
+	assert.Equal(t, int64(300), chain.Stake(b))
+	assert.Equal(t, int64(50), chain.Stake(c))
+
+	// the set only changes at the end of an epoch
+	assert.Empty(t, chain.Validators(chain.Tip().Header))
+	assert.ErrorIs(t, chain.AddBlock(randomBlock(t, chain)), ErrInvalidBlock)
+
+	block, _ := buildBlock(t, chain, nil, nil)
+	elected := [][]byte{b, a}
+	assert.Equal(t, elected, chain.Validators(chain.Tip().Header))
+	assert.Equal(t, types.HashValidators(nil), block.Header.ValidatorsHash)
+	assert.Equal(t, types.HashValidators(elected), block.Header.NextValidatorsHash)
+	assert.True(t, chain.IsValidator(a))
+	assert.False(t, chain.IsValidator(c))
+
+	// the stakes and sets are rebuilt when the chain is reloaded
+	reloaded, err := NewChain(stakeGenesis(), chain.blockStore, chain.txStore, chain.utxoStore, chain.journal)
+	require.Nil(t, err)
+	assert.Equal(t, int64(300), reloaded.Stake(b))
+	assert.Equal(t, elected, reloaded.Validators(reloaded.Tip().Header))
+}
+
+func TestStakeUnbond(t *testing.T) {
+	var (
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr      = prvKey.PublicKey().Address().Bytes()
+		validator = crypto.GeneratePrivateKey().PublicKey().Bytes()
+	)
+	chain, err := NewChain(stakeGenesis(), NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+
+	bond := typedTx(prvKey, proto.TxType_BOND, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 1000, Address: addr, Validator: validator},
+	)
+
+	// stake can not be unbonded in the block that bonds it
+	unbond := typedTx(prvKey, proto.TxType_UNBOND, bond, 0, &proto.TxOutput{Amount: 1000, Address: addr, Validator: validator})
+	block, leftover, err := chain.BuildBlock(prvKey.PublicKey(), []*proto.Transaction{bond, unbond}, nil, time.Now())
+	require.Nil(t, err)
+	assert.Equal(t, []*proto.Transaction{unbond}, leftover)
+	require.Nil(t, chain.Engine().Seal(chain, block, prvKey, nil))
+	require.Nil(t, chain.AddBlock(block))
+
+	// bonded stake is only released by an unbond transaction, whose outputs
+	// name the validator they are unbonded from
+	transfer := spendTx(prvKey, bond, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	assert.ErrorIs(t, chain.ValidateTransaction(transfer), ErrBondedOutput)
+	anonymous := typedTx(prvKey, proto.TxType_UNBOND, bond, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	assert.ErrorIs(t, chain.ValidateTransaction(anonymous), ErrMalformedTx)
+
+	buildBlock(t, chain, nil, nil, unbond)
+	assert.Equal(t, int64(0), chain.Stake(validator))
+
+	// unbonded coins are locked for the unbonding period
+	spend := spendTx(prvKey, unbond, 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	assert.ErrorIs(t, chain.ValidateTransaction(spend), ErrUnbonding)
+	buildBlock(t, chain, nil, nil)
+	assert.ErrorIs(t, chain.ValidateTransaction(spend), ErrUnbonding)
+	buildBlock(t, chain, nil, nil)
+	buildBlock(t, chain, nil, nil, spend)
+
+	// disconnecting the unbond restores the stake
+	for chain.Height() > 1 {
+		_, err := chain.disconnectTip()
+		require.Nil(t, err)
+	}
+	assert.Equal(t, int64(1000), chain.Stake(validator))
+}
+
+func TestStakeInvalidTransactions(t *testing.T) {
+	var (
+		chain     = newTestChain(t)
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr      = prvKey.PublicKey().Address().Bytes()
+		prevTx    = genesisTx(t, chain)
+		validator = crypto.GeneratePrivateKey().PublicKey().Bytes()
+	)
+
+	for name, tx := range map[string]*proto.Transaction{
+		"bond without stake":    typedTx(prvKey, proto.TxType_BOND, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr}),
+		"stake in a transfer":   spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr, Validator: validator}),
+		"invalid validator key": typedTx(prvKey, proto.TxType_BOND, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr, Validator: addr}),
+		"unbond unbonded coins": typedTx(prvKey, proto.TxType_UNBOND, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr}),
+		"unknown type":          typedTx(prvKey, proto.TxType(7), prevTx, 0, &proto.TxOutput{Amount: 1000, Address: addr}),
+	} {
+		assert.ErrorIs(t, chain.ValidateTransaction(tx), ErrMalformedTx, name)
+	}
+
+	cb := types.GenerateCoinbaseTx(1, addr, 1)
+	cb.Type = proto.TxType_BOND
+	assert.ErrorIs(t, chain.AddBlock(coinbaseBlock(t, chain, cb)), ErrInvalidCoinbase)
+	cb = types.GenerateCoinbaseTx(1, addr, 1)
+	cb.Outputs[0].Validator = validator
+	assert.ErrorIs(t, chain.AddBlock(coinbaseBlock(t, chain, cb)), ErrInvalidCoinbase)
+}
@@ -0,0 +1,200 @@
+package node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+)
+
+// stateKey returns the key of an output in the state tree, the hash of the
+// transaction hash and the output index
+func stateKey(txHash []byte, outIndex int) []byte {
+	h := sha256.New()
+	h.Write(txHash)
+	binary.Write(h, binary.BigEndian, uint32(outIndex))
+	return h.Sum(nil)
+}
+
+// utxoStateKey returns the key of the utxo in the state tree
+func utxoStateKey(utxo *UTXO) []byte {
+	txHash, err := hex.DecodeString(utxo.Hash)
+	if err != nil {
+		panic(err)
+	}
+	return stateKey(txHash, utxo.OutIndex)
+}
+
+// stateValue is an utxo as a value of the state tree
+type stateValue struct {
+	utxo *UTXO
+}
+
+// Hash returns the hash of everything the chain knows about the utxo. The
+// fields are written like the canonical encoding of types.
+func (v stateValue) Hash() []byte {
+	var (
+		u         = v.utxo
+		buf       []byte
+		txHash, _ = hex.DecodeString(u.Hash)
+	)
+	writeBytes := func(b []byte) {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+		buf = append(buf, b...)
+	}
+	writeBool := func(b bool) {
+		if b {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	}
+
+	buf = append(buf, types.EncodingVersion)
+	writeBytes(txHash)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(u.OutIndex))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(u.Amount))
+	writeBytes(u.Address)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(u.Height))
+	writeBool(u.Coinbase)
+	writeBytes(u.Validator)
+	writeBool(u.Unbonding)
+
+	hash := sha256.Sum256(buf)
+	return hash[:]
+}
+
+// leafHash is the value hash of a stored leaf of the state tree
+type leafHash []byte
+
+func (h leafHash) Hash() []byte {
+	return h
+}
+
+// loadState rebuilds the state tree from the leaves kept in the utxo store
+func loadState(us UTXOSore) (*util.SparseMerkleTree, error) {
+	leaves, err := us.StateLeaves()
+	if err != nil {
+		return nil, err
+	}
+
+	state := util.NewSparseMerkleTree()
+	for key, hash := range leaves {
+		k, err := hex.DecodeString(key)
+		if err != nil || len(k) != util.SparseKeyLen {
+			return nil, fmt.Errorf("invalid state leaf key %q", key)
+		}
+		state = state.Update(k, leafHash(hash))
+	}
+	return state, nil
+}
+
+// connectState returns the state tree with the outputs the block created
+// added and the outputs it spent removed. Outputs created and spent in the
+// block never show up.
+func connectState(state *util.SparseMerkleTree, block *proto.Block) *util.SparseMerkleTree {
+	height := int(block.Header.Height)
+	for _, tx := range block.Transactions {
+		for _, utxo := range txOutputs(tx, height) {
+			state = state.Update(utxoStateKey(utxo), stateValue{utxo})
+		}
+	}
+	for _, tx := range block.Transactions {
+		if types.IsCoinbaseTx(tx) {
+			continue
+		}
+		for _, input := range tx.Inputs {
+			state = state.Delete(stateKey(input.PrevTxHash, int(input.PrevOutIndex)))
+		}
+	}
+	return state
+}
+
+// disconnectState reverts connectState for a block that spent the given
+// utxos
+func disconnectState(state *util.SparseMerkleTree, block *proto.Block, spent []*UTXO) *util.SparseMerkleTree {
+	for _, tx := range block.Transactions {
+		hash := types.HashTransaction(tx)
+		for i := range tx.Outputs {
+			state = state.Delete(stateKey(hash, i))
+		}
+	}
+	for _, utxo := range spent {
+		state = state.Update(utxoStateKey(utxo), stateValue{utxo})
+	}
+	return state
+}
+
+// verifyStateRoot checks that the header of a block on top of the tip
+// commits to the utxo set after the block. Headers older than the state root
+// have none.
+func (c *Chain) verifyStateRoot(block *proto.Block) error {
+	header := block.Header
+	if header.Version < types.StateRootVersion {
+		if len(header.StateRoot) > 0 {
+			return fmt.Errorf("%w: %w: version %d has no state root", ErrInvalidBlock, ErrStateRoot, header.Version)
+		}
+		return nil
+	}
+
+	if root := connectState(c.state, block).Root(); !bytes.Equal(header.StateRoot, root) {
+		return fmt.Errorf("%w: %w: %x, the utxo set has %x", ErrInvalidBlock, ErrStateRoot, header.StateRoot, root)
+	}
+	return nil
+}
+
+// StateRoot returns the root of the state tree of the utxo set at the tip
+func (c *Chain) StateRoot() []byte {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.state.Root()
+}
+
+// GetUTXOProof returns the output at outIndex of the transaction with the
+// given hash and the proof that it is part of the utxo set at the tip, or a
+// nil utxo and the proof that it is not.
+func (c *Chain) GetUTXOProof(txHash []byte, outIndex int) (*UTXO, *util.SparseMerkleProof, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	key := stateKey(txHash, outIndex)
+	proof := c.state.Prove(key)
+	if _, ok := c.state.Get(key); !ok {
+		return nil, proof, nil
+	}
+
+	utxo, err := c.utxoStore.Get(utxoKey(hex.EncodeToString(txHash), outIndex))
+	if err != nil {
+		return nil, nil, err
+	}
+	return utxo, proof, nil
+}
+
+// VerifyUTXOProof checks that the output at outIndex of the transaction with
+// the given hash is the utxo in the utxo set after the block with the given
+// header, or that it is not in the set if utxo is nil.
+func VerifyUTXOProof(header *proto.Header, txHash []byte, outIndex int, utxo *UTXO, proof *util.SparseMerkleProof) error {
+	if header.Version < types.StateRootVersion {
+		return fmt.Errorf("%w: version %d headers have no state root", ErrInvalidProof, header.Version)
+	}
+
+	key := stateKey(txHash, outIndex)
+	if utxo == nil {
+		if !proof.VerifyNonMembership(header.StateRoot, key) {
+			return fmt.Errorf("%w: output %x_%d may be unspent", ErrInvalidProof, txHash, outIndex)
+		}
+		return nil
+	}
+
+	if utxo.Hash != hex.EncodeToString(txHash) || utxo.OutIndex != outIndex {
+		return fmt.Errorf("%w: utxo %s is not output %x_%d", ErrInvalidProof, utxo.Key(), txHash, outIndex)
+	}
+	if !proof.VerifyMembership(header.StateRoot, key, stateValue{utxo}) {
+		return fmt.Errorf("%w: utxo %s is not in the utxo set", ErrInvalidProof, utxo.Key())
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestChainStateRoot(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	assert.Equal(t, genesis.Header.StateRoot, chain.StateRoot())
+
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 400, Address: addr},
+		&proto.TxOutput{Amount: 600, Address: addr},
+	)
+
+	// a block committing to any other utxo set is rejected
+	b := randomBlock(t, chain)
+	b.Transactions = append(b.Transactions, tx)
+	types.SignBlock(crypto.GeneratePrivateKey(), b)
+	assert.ErrorIs(t, chain.AddBlock(b), ErrStateRoot)
+	assert.Equal(t, genesis.Header.StateRoot, chain.StateRoot())
+
+	require.Nil(t, addTxBlock(t, chain, tx))
+	assert.Equal(t, chain.Tip().Header.StateRoot, chain.StateRoot())
+	assert.NotEqual(t, genesis.Header.StateRoot, chain.StateRoot())
+
+	// disconnecting the block brings back the state of the genesis
+	_, err = chain.disconnectTip()
+	require.Nil(t, err)
+	assert.Equal(t, genesis.Header.StateRoot, chain.StateRoot())
+
+	// built blocks commit to the state after them
+	block, _, err := chain.BuildBlock(prvKey.PublicKey(), []*proto.Transaction{tx}, nil, time.Now())
+	require.Nil(t, err)
+	types.SignBlock(prvKey, block)
+	require.Nil(t, chain.AddBlock(block))
+	assert.Equal(t, block.Header.StateRoot, chain.StateRoot())
+}
+
+func TestChainReloadState(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+	)
+	tx := spendTx(prvKey, genesisTx(t, chain), 0,
+		&proto.TxOutput{Amount: 400, Address: addr},
+		&proto.TxOutput{Amount: 600, Address: addr},
+	)
+	require.Nil(t, addTxBlock(t, chain, tx))
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+	_, err := chain.disconnectTip()
+	require.Nil(t, err)
+
+	// the state tree is loaded from the leaves stored with the utxo set
+	leaves, err := chain.utxoStore.StateLeaves()
+	require.Nil(t, err)
+	assert.Len(t, leaves, 3)
+	reloaded, err := NewChain(testGenesis(), chain.blockStore, chain.txStore, chain.utxoStore, chain.journal)
+	require.Nil(t, err)
+	assert.Equal(t, chain.StateRoot(), reloaded.StateRoot())
+
+	// leaves that do not match the tip are refused
+	require.Nil(t, chain.utxoStore.DeleteStateLeaf(hex.EncodeToString(stateKey(types.HashTransaction(tx), 0))))
+	_, err = NewChain(testGenesis(), chain.blockStore, chain.txStore, chain.utxoStore, chain.journal)
+	assert.ErrorIs(t, err, ErrStateRoot)
+}
+
+func TestUTXOProof(t *testing.T) {
+	var (
+		chain     = newTestChain(t)
+		prvKey    = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+		prevTx    = genesisTx(t, chain)
+	)
+	tx := spendTx(prvKey, prevTx, 0, &proto.TxOutput{Amount: 1000, Address: recipient})
+	require.Nil(t, addTxBlock(t, chain, tx))
+	header := chain.Tip().Header
+
+	// an unspent output
+	txHash := types.HashTransaction(tx)
+	utxo, proof, err := chain.GetUTXOProof(txHash, 0)
+	require.Nil(t, err)
+	require.NotNil(t, utxo)
+	assert.Equal(t, recipient, utxo.Address)
+	require.Nil(t, VerifyUTXOProof(header, txHash, 0, utxo, proof))
+
+	// the proof does not hold for another utxo or output
+	forged := *utxo
+	forged.Amount++
+	assert.ErrorIs(t, VerifyUTXOProof(header, txHash, 0, &forged, proof), ErrInvalidProof)
+	assert.ErrorIs(t, VerifyUTXOProof(header, txHash, 1, utxo, proof), ErrInvalidProof)
+	assert.ErrorIs(t, VerifyUTXOProof(header, txHash, 0, nil, proof), ErrInvalidProof)
+
+	// a spent output
+	prevHash := types.HashTransaction(prevTx)
+	utxo, proof, err = chain.GetUTXOProof(prevHash, 0)
+	require.Nil(t, err)
+	assert.Nil(t, utxo)
+	require.Nil(t, VerifyUTXOProof(header, prevHash, 0, nil, proof))
+
+	// the genesis header still has the output
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	assert.ErrorIs(t, VerifyUTXOProof(genesis.Header, prevHash, 0, nil, proof), ErrInvalidProof)
+
+	// older headers have no state root to prove against
+	legacy := &proto.Header{Version: types.StateRootVersion - 1}
+	assert.ErrorIs(t, VerifyUTXOProof(legacy, prevHash, 0, nil, proof), ErrInvalidProof)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/fzft/crypto-prd-blockchain/proto"
 	"github.com/fzft/crypto-prd-blockchain/types"
 	"github.com/fzft/crypto-prd-blockchain/util"
+	"sync"
 )
 
 type TxStore interface {
@@ -16,20 +17,49 @@ type TxStore interface {
 type BlockStore interface {
 	Put(buffer *proto.Block) error
 	Get(string) (*proto.Block, error)
+	PutUndo(string, *BlockUndo) error
+	GetUndo(string) (*BlockUndo, error)
+
+	// PutCommit stores the commit certificate of the block with the given hash
+	PutCommit(string, *proto.CommitCertificate) error
+	GetCommit(string) (*proto.CommitCertificate, error)
 }
 
 type UTXOSore interface {
 	Put(utxo *UTXO) error
 	Get(string) (*UTXO, error)
+	Delete(string) error
+
+	// SetBestBlock records the hash of the block the utxo set belongs to
+	SetBestBlock(string) error
+	// BestBlock returns the hash of the block the utxo set belongs to, or an
+	// empty string for an empty store
+	BestBlock() (string, error)
+
+	// PutStateLeaf stores the value hash of a leaf of the state tree of the
+	// utxo set under the hex encoded key of the leaf
+	PutStateLeaf(key string, hash []byte) error
+	DeleteStateLeaf(key string) error
+	// StateLeaves returns the stored leaves of the state tree
+	StateLeaves() (map[string][]byte, error)
+}
+
+// utxoKey returns the key of the output at outIndex of the transaction with the given hash.
+func utxoKey(txHash string, outIndex int) string {
+	return fmt.Sprintf("%s_%d", txHash, outIndex)
 }
 
 type MemoryBlockStore struct {
-	blocks *util.KeyValueStore[string, *proto.Block]
+	blocks  *util.KeyValueStore[string, *proto.Block]
+	undo    *util.KeyValueStore[string, *BlockUndo]
+	commits *util.KeyValueStore[string, *proto.CommitCertificate]
 }
 
 func NewMemoryBlockStore() *MemoryBlockStore {
 	return &MemoryBlockStore{
-		blocks: util.NewKeyValueStore[string, *proto.Block](),
+		blocks:  util.NewKeyValueStore[string, *proto.Block](),
+		undo:    util.NewKeyValueStore[string, *BlockUndo](),
+		commits: util.NewKeyValueStore[string, *proto.CommitCertificate](),
 	}
 }
 
@@ -47,6 +77,32 @@ func (m *MemoryBlockStore) Get(hash string) (*proto.Block, error) {
 	return block, nil
 }
 
+func (m *MemoryBlockStore) PutUndo(hash string, undo *BlockUndo) error {
+	m.undo.Put(hash, undo)
+	return nil
+}
+
+func (m *MemoryBlockStore) GetUndo(hash string) (*BlockUndo, error) {
+	undo, ok := m.undo.Get(hash)
+	if !ok {
+		return nil, fmt.Errorf("undo data for block %s not found", hash)
+	}
+	return undo, nil
+}
+
+func (m *MemoryBlockStore) PutCommit(hash string, cert *proto.CommitCertificate) error {
+	m.commits.Put(hash, cert)
+	return nil
+}
+
+func (m *MemoryBlockStore) GetCommit(hash string) (*proto.CommitCertificate, error) {
+	cert, ok := m.commits.Get(hash)
+	if !ok {
+		return nil, fmt.Errorf("commit of block %s not found", hash)
+	}
+	return cert, nil
+}
+
 type MemoryTxStore struct {
 	txx *util.KeyValueStore[string, *proto.Transaction]
 }
@@ -73,16 +129,21 @@ func (m *MemoryTxStore) Get(hash string) (*proto.Transaction, error) {
 
 type MemoryUTXOStore struct {
 	utxos *util.KeyValueStore[string, *UTXO]
+
+	lock      sync.RWMutex
+	bestBlock string
+	leaves    map[string][]byte
 }
 
 func NewMemoryUTXOStore() *MemoryUTXOStore {
 	return &MemoryUTXOStore{
-		utxos: util.NewKeyValueStore[string, *UTXO](),
+		utxos:  util.NewKeyValueStore[string, *UTXO](),
+		leaves: make(map[string][]byte),
 	}
 }
 
 func (m *MemoryUTXOStore) Put(utxo *UTXO) error {
-	key := fmt.Sprintf("%s_%d", utxo.Hash, utxo.OutIndex)
+	key := utxoKey(utxo.Hash, utxo.OutIndex)
 
 	m.utxos.Put(key, utxo)
 	return nil
@@ -95,3 +156,45 @@ func (m *MemoryUTXOStore) Get(hash string) (*UTXO, error) {
 	}
 	return utxo, nil
 }
+
+func (m *MemoryUTXOStore) Delete(hash string) error {
+	m.utxos.Delete(hash)
+	return nil
+}
+
+func (m *MemoryUTXOStore) SetBestBlock(hash string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bestBlock = hash
+	return nil
+}
+
+func (m *MemoryUTXOStore) BestBlock() (string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.bestBlock, nil
+}
+
+func (m *MemoryUTXOStore) PutStateLeaf(key string, hash []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.leaves[key] = hash
+	return nil
+}
+
+func (m *MemoryUTXOStore) DeleteStateLeaf(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.leaves, key)
+	return nil
+}
+
+func (m *MemoryUTXOStore) StateLeaves() (map[string][]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	leaves := make(map[string][]byte, len(m.leaves))
+	for key, hash := range m.leaves {
+		leaves[key] = hash
+	}
+	return leaves, nil
+}
@@ -0,0 +1,305 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/consensus"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"io"
+	"sync"
+)
+
+const (
+	maxHeadersPerRequest = 2000
+	maxBlocksPerRequest  = 16
+)
+
+// GetHeaders streams the main chain headers following the first locator hash
+// we know of.
+func (n *Node) GetHeaders(req *proto.GetHeadersRequest, stream proto.Node_GetHeadersServer) error {
+	limit := int(req.Limit)
+	if limit <= 0 || limit > maxHeadersPerRequest {
+		limit = maxHeadersPerRequest
+	}
+
+	for _, header := range n.Chain.HeadersAfter(req.Locator, limit) {
+		if err := stream.Send(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBlocks streams the requested blocks. Unknown hashes are skipped.
+func (n *Node) GetBlocks(req *proto.GetBlocksRequest, stream proto.Node_GetBlocksServer) error {
+	if len(req.Hashes) > maxBlocksPerRequest {
+		return fmt.Errorf("too many blocks requested (%d) - max (%d)", len(req.Hashes), maxBlocksPerRequest)
+	}
+
+	for _, hash := range req.Hashes {
+		block, err := n.Chain.GetBlockByHash(hash)
+		if err != nil {
+			continue
+		}
+		if err := stream.Send(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTxProof returns the proof that a transaction is part of a block we know
+func (n *Node) GetTxProof(ctx context.Context, req *proto.GetTxProofRequest) (*proto.TxProof, error) {
+	block, err := n.Chain.GetBlockByHash(req.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTxProof(block, req.TxHash)
+}
+
+// GetCommit returns the commit certificate of a block we know
+func (n *Node) GetCommit(ctx context.Context, req *proto.GetCommitRequest) (*proto.CommitCertificate, error) {
+	return n.Chain.GetCommit(req.BlockHash)
+}
+
+// syncWithPeers syncs with the connected peers one after another until the
+// chain reaches the given height.
+func (n *Node) syncWithPeers(height int) {
+	n.peerLock.RLock()
+	peers := make([]proto.NodeClient, 0, len(n.peers))
+	for peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	n.peerLock.RUnlock()
+
+	for _, peer := range peers {
+		if n.Chain.Height() >= height {
+			return
+		}
+		if err := n.syncWith(peer, height); err != nil {
+			n.logger.Errorf("Error syncing - %s", err)
+		}
+	}
+}
+
+// syncWith downloads the blocks we are missing if the peer is ahead of us.
+// The headers are fetched from the peer first, then the blocks are fetched in
+// parallel from all peers that have them and added to the chain in order.
+func (n *Node) syncWith(peer proto.NodeClient, height int) error {
+	if height <= n.Chain.Height() {
+		return nil
+	}
+	if !n.syncing.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer n.syncing.Store(false)
+
+	n.logger.Infow("starting sync", "height", n.Chain.Height(), "target", height, "we", n.ListenAddr)
+
+	locator := n.Chain.Locator()
+	for {
+		headers, err := n.fetchHeaders(peer, locator)
+		if err != nil {
+			return err
+		}
+		if len(headers) == 0 {
+			break
+		}
+
+		var missing [][]byte
+		for _, header := range headers {
+			if hash := types.HashHeader(header); !n.Chain.HasBlock(hash) {
+				missing = append(missing, hash)
+			}
+		}
+
+		last := headers[len(headers)-1]
+		blocks, err := n.fetchBlocks(peer, missing, int(last.Height))
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range missing {
+			key := hex.EncodeToString(hash)
+			err := n.Chain.AddBlock(blocks[key])
+			// like HandleBlock, a block refused for now may be relayed again
+			if !isTemporaryBlockError(err) {
+				n.seenBlocks.Put(key, true)
+			}
+			if err != nil && !errors.Is(err, ErrKnownBlock) {
+				return err
+			}
+		}
+		if _, ok := n.Chain.Engine().(consensus.Finality); ok {
+			if err := n.commitHeaders(peer, headers); err != nil {
+				return err
+			}
+		}
+
+		locator = [][]byte{types.HashHeader(last)}
+	}
+
+	n.logger.Infow("sync done", "height", n.Chain.Height(), "we", n.ListenAddr)
+	return nil
+}
+
+// commitHeaders fetches the certificate of the last of the headers the peer
+// has one for and commits it. With an engine that has finality the blocks
+// only join the main chain once committed, a certificate commits the blocks
+// before it too.
+func (n *Node) commitHeaders(peer proto.NodeClient, headers []*proto.Header) error {
+	for i := len(headers) - 1; i >= 0; i-- {
+		cert, err := peer.GetCommit(context.Background(), &proto.GetCommitRequest{BlockHash: types.HashHeader(headers[i])})
+		if err != nil {
+			continue
+		}
+		return n.Chain.CommitBlock(cert)
+	}
+	return fmt.Errorf("%w: peer has no certificate for the synced blocks", consensus.ErrInvalidCommit)
+}
+
+// fetchHeaders fetches the headers following the locator from the peer and
+// checks that they form a chain on top of a block we know.
+func (n *Node) fetchHeaders(peer proto.NodeClient, locator [][]byte) ([]*proto.Header, error) {
+	stream, err := peer.GetHeaders(context.Background(), &proto.GetHeadersRequest{
+		Locator: locator,
+		Limit:   maxHeadersPerRequest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []*proto.Header
+	for {
+		header, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(headers) == 0 {
+			if !n.Chain.HasBlock(header.PrevHash) {
+				return nil, fmt.Errorf("%w: header does not connect to a known block", ErrOrphanBlock)
+			}
+		} else {
+			prev := headers[len(headers)-1]
+			if !bytes.Equal(header.PrevHash, types.HashHeader(prev)) || header.Height != prev.Height+1 {
+				return nil, fmt.Errorf("peer sent headers that do not form a chain")
+			}
+		}
+
+		headers = append(headers, header)
+		if len(headers) > maxHeadersPerRequest {
+			return nil, fmt.Errorf("peer sent too many headers")
+		}
+	}
+
+	return headers, nil
+}
+
+// fetchBlocks fetches the blocks with the given hashes in parallel from all
+// peers at or above the given height. Requests failing on other peers are
+// retried on the sync peer.
+func (n *Node) fetchBlocks(syncPeer proto.NodeClient, hashes [][]byte, height int) (map[string]*proto.Block, error) {
+	peers := n.peersAtHeight(height)
+	if len(peers) == 0 {
+		peers = append(peers, syncPeer)
+	}
+
+	var (
+		pool   = util.NewWorkerPool(len(peers), len(hashes)/maxBlocksPerRequest+1)
+		lock   sync.Mutex
+		blocks = make(map[string]*proto.Block, len(hashes))
+	)
+	defer pool.Stop()
+
+	for i := 0; i < len(hashes); i += maxBlocksPerRequest {
+		end := i + maxBlocksPerRequest
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		chunk := hashes[i:end]
+		peer := peers[(i/maxBlocksPerRequest)%len(peers)]
+		pool.Submit(func() {
+			received, err := requestBlocks(peer, chunk)
+			if err != nil && peer != syncPeer {
+				received, err = requestBlocks(syncPeer, chunk)
+			}
+			if err != nil {
+				n.logger.Errorf("Error fetching blocks - %s", err)
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			for hash, block := range received {
+				blocks[hash] = block
+			}
+		})
+	}
+	pool.Wait()
+
+	for _, hash := range hashes {
+		if _, ok := blocks[hex.EncodeToString(hash)]; !ok {
+			return nil, fmt.Errorf("block %x could not be fetched", hash)
+		}
+	}
+	return blocks, nil
+}
+
+// requestBlocks requests the blocks with the given hashes from the peer
+func requestBlocks(peer proto.NodeClient, hashes [][]byte) (map[string]*proto.Block, error) {
+	stream, err := peer.GetBlocks(context.Background(), &proto.GetBlocksRequest{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		requested[hex.EncodeToString(hash)] = true
+	}
+
+	blocks := make(map[string]*proto.Block, len(hashes))
+	for {
+		block, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hash := hex.EncodeToString(types.HashBlock(block))
+		if !requested[hash] {
+			return nil, fmt.Errorf("peer sent unrequested block %s", hash)
+		}
+		blocks[hash] = block
+	}
+
+	if len(blocks) != len(hashes) {
+		return nil, fmt.Errorf("peer sent %d of %d blocks", len(blocks), len(hashes))
+	}
+	return blocks, nil
+}
+
+// peersAtHeight returns the peers that reported at least the given height
+func (n *Node) peersAtHeight(height int) []proto.NodeClient {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	var peers []proto.NodeClient
+	for peer, version := range n.peers {
+		if int(version.Height) >= height {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address nobody listens on
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestSyncFromPeer(t *testing.T) {
+	var (
+		validator = New(ServerConfig{PrivateKey: crypto.GeneratePrivateKey(), Genesis: testGenesis()})
+		n         = New(ServerConfig{Genesis: testGenesis()})
+		height    = 2*maxBlocksPerRequest + 3
+	)
+
+	for i := 0; i < height; i++ {
+		_, err := validator.produceBlock()
+		require.Nil(t, err)
+	}
+
+	validatorAddr := freeAddr(t)
+	go validator.Start(validatorAddr)
+	time.Sleep(100 * time.Millisecond)
+	go n.Start(freeAddr(t), validatorAddr)
+
+	assert.Eventually(t, func() bool {
+		return n.Chain.Height() == height
+	}, 5*time.Second, 50*time.Millisecond)
+
+	for i := 0; i <= height; i++ {
+		expected, err := validator.Chain.GetBlockByHeight(i)
+		require.Nil(t, err)
+		block, err := n.Chain.GetBlockByHeight(i)
+		require.Nil(t, err)
+		assert.Equal(t, expected.Signature, block.Signature)
+	}
+}
+
+func TestSyncTemporaryBlockError(t *testing.T) {
+	chain := newTestChain(t)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+
+	// the peer serves a block too far in the future for us
+	early := childBlock(chain, genesis)
+	early.Header.Timestamp = time.Now().Add(time.Hour).UnixNano()
+	signBlock(chain, crypto.GeneratePrivateKey(), early)
+	require.Nil(t, chain.addBlock(early))
+
+	var (
+		peer     = New(ServerConfig{Chain: chain})
+		n        = New(ServerConfig{Genesis: testGenesis()})
+		peerAddr = freeAddr(t)
+	)
+	go peer.Start(peerAddr)
+	time.Sleep(100 * time.Millisecond)
+	client, err := makeNodeClient(peerAddr)
+	require.Nil(t, err)
+
+	assert.ErrorIs(t, n.syncWith(client, 1), ErrTimeTooNew)
+	assert.False(t, n.seenBlocks.Has(hex.EncodeToString(types.HashBlock(early))))
+	_, err = n.HandleBlock(context.Background(), early)
+	assert.ErrorIs(t, err, ErrTimeTooNew)
+}
+
+func TestSyncCommittedBlocks(t *testing.T) {
+	var (
+		keys    = bftKeys(4)
+		genesis = bftGenesis(keys...)
+		height  = 3
+	)
+	chain, err := NewChain(genesis, NewMemoryBlockStore(), NewMemoryTxStore(), NewMemoryUTXOStore(), NewMemoryJournal())
+	require.Nil(t, err)
+	tip, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	for i := 0; i < height; i++ {
+		tip = validatorBlock(chain, tip, keys[i])
+		require.Nil(t, chain.AddBlock(tip))
+		require.Nil(t, chain.CommitBlock(commitCert(tip, 0, keys...)))
+	}
+
+	var (
+		peer     = New(ServerConfig{Chain: chain})
+		n        = New(ServerConfig{Genesis: genesis})
+		peerAddr = freeAddr(t)
+	)
+	go peer.Start(peerAddr)
+	time.Sleep(100 * time.Millisecond)
+	go n.Start(freeAddr(t), peerAddr)
+
+	// the synced blocks join the main chain with the certificate of the last
+	assert.Eventually(t, func() bool {
+		return n.Chain.Committed().Height == height
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, chain.Tip().Hash, n.Chain.Tip().Hash)
+}
+
+func TestGetTxProof(t *testing.T) {
+	var (
+		chain  = newTestChain(t)
+		n      = New(ServerConfig{Chain: chain})
+		prvKey = crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+		addr   = prvKey.PublicKey().Address().Bytes()
+	)
+	tx := spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 1000, Address: addr})
+	require.Nil(t, addTxBlock(t, chain, tx))
+	require.Nil(t, chain.AddBlock(randomBlock(t, chain)))
+
+	block, err := chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	req := &proto.GetTxProofRequest{BlockHash: types.HashBlock(block), TxHash: types.HashTransaction(tx)}
+	proof, err := n.GetTxProof(context.Background(), req)
+	require.Nil(t, err)
+
+	// a light client only keeps the headers
+	light := NewHeaderList()
+	for height := 0; height <= chain.Height(); height++ {
+		block, err := chain.GetBlockByHeight(height)
+		require.Nil(t, err)
+		light.AddHeader(block.Header)
+	}
+	require.Nil(t, light.VerifyTxProof(proof))
+
+	proof.Height = 2
+	assert.ErrorIs(t, light.VerifyTxProof(proof), ErrInvalidProof)
+	proof.Height = 3
+	assert.ErrorIs(t, light.VerifyTxProof(proof), ErrInvalidProof)
+	proof.Height = 1
+	proof.Transaction = spendTx(prvKey, genesisTx(t, chain), 0, &proto.TxOutput{Amount: 999, Address: addr})
+	assert.ErrorIs(t, light.VerifyTxProof(proof), ErrInvalidProof)
+
+	_, err = n.GetTxProof(context.Background(), &proto.GetTxProofRequest{BlockHash: req.BlockHash, TxHash: util.RandomHash()})
+	assert.NotNil(t, err)
+	_, err = n.GetTxProof(context.Background(), &proto.GetTxProofRequest{BlockHash: util.RandomHash(), TxHash: req.TxHash})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,185 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/types"
+)
+
+type UTXO struct {
+	Hash     string
+	OutIndex int
+	Amount   int64
+	Address  []byte
+	Spent    bool
+
+	// Height is the height of the block that created the output
+	Height int
+	// Coinbase is set for outputs of a coinbase, they have to mature
+	// before they can be spent
+	Coinbase bool
+
+	// Validator is the public key of the validator the output is bonded to,
+	// or unbonding from. Bonded outputs can only be spent by an unbond
+	// transaction.
+	Validator []byte
+	// Unbonding is set for outputs of an unbond transaction, they are locked
+	// for the unbonding period and slashed if their validator is jailed
+	// meanwhile
+	Unbonding bool
+}
+
+// Key returns the key of the utxo in the utxo store
+func (u *UTXO) Key() string {
+	return utxoKey(u.Hash, u.OutIndex)
+}
+
+// Bonded returns true if the output is stake bonded to a validator
+func (u *UTXO) Bonded() bool {
+	return len(u.Validator) > 0 && !u.Unbonding
+}
+
+// BlockUndo holds the utxos a block consumed, so the block can be disconnected
+// and the utxo set restored to the state before the block.
+type BlockUndo struct {
+	Spent []*UTXO
+}
+
+// utxoView stages changes to the utxo set on top of a store, so a whole block
+// can be applied before anything is written. Outputs added to the view are
+// created at the height of the view.
+type utxoView struct {
+	store   UTXOSore
+	height  int
+	added   map[string]*UTXO
+	spent   map[string]bool
+	order   []string
+	consume []*UTXO
+}
+
+func newUTXOView(store UTXOSore, height int) *utxoView {
+	return &utxoView{
+		store:  store,
+		height: height,
+		added:  make(map[string]*UTXO),
+		spent:  make(map[string]bool),
+	}
+}
+
+// Get returns the unspent output with the given key
+func (v *utxoView) Get(key string) (*UTXO, error) {
+	if utxo, ok := v.added[key]; ok {
+		return utxo, nil
+	}
+	if v.spent[key] {
+		return nil, fmt.Errorf("%w: %s", ErrInputSpent, key)
+	}
+
+	utxo, err := v.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownInput, key)
+	}
+	if utxo.Spent {
+		return nil, fmt.Errorf("%w: %s", ErrInputSpent, key)
+	}
+	return utxo, nil
+}
+
+// Spend marks the output with the given key as spent
+func (v *utxoView) Spend(key string) error {
+	if _, ok := v.added[key]; ok {
+		// created and spent within the view, the store never sees it
+		delete(v.added, key)
+		v.spent[key] = true
+		return nil
+	}
+
+	utxo, err := v.Get(key)
+	if err != nil {
+		return err
+	}
+	v.spent[key] = true
+	v.consume = append(v.consume, utxo)
+	return nil
+}
+
+// Add adds an unspent output to the view
+func (v *utxoView) Add(utxo *UTXO) {
+	key := utxo.Key()
+	if _, ok := v.added[key]; !ok {
+		v.order = append(v.order, key)
+	}
+	delete(v.spent, key)
+	v.added[key] = utxo
+}
+
+// ApplyTx spends the inputs and adds the outputs of the transaction
+func (v *utxoView) ApplyTx(tx *proto.Transaction) error {
+	if types.IsCoinbaseTx(tx) {
+		// a coinbase creates new coins and has nothing to spend
+		v.addOutputs(tx)
+		return nil
+	}
+
+	for _, input := range tx.Inputs {
+		key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+		if err := v.Spend(key); err != nil {
+			return err
+		}
+	}
+
+	v.addOutputs(tx)
+	return nil
+}
+
+// addOutputs adds the outputs of the transaction to the view
+func (v *utxoView) addOutputs(tx *proto.Transaction) {
+	for _, utxo := range txOutputs(tx, v.height) {
+		v.Add(utxo)
+	}
+}
+
+// txOutputs returns the utxos of the outputs of a transaction in a block at
+// the given height
+func txOutputs(tx *proto.Transaction, height int) []*UTXO {
+	var (
+		hash     = hex.EncodeToString(types.HashTransaction(tx))
+		coinbase = types.IsCoinbaseTx(tx)
+		utxos    = make([]*UTXO, len(tx.Outputs))
+	)
+	for i, output := range tx.Outputs {
+		utxos[i] = &UTXO{
+			Hash:      hash,
+			OutIndex:  i,
+			Amount:    output.Amount,
+			Address:   output.Address,
+			Spent:     false,
+			Height:    height,
+			Coinbase:  coinbase,
+			Validator: output.Validator,
+			Unbonding: tx.Type == proto.TxType_UNBOND,
+		}
+	}
+	return utxos
+}
+
+// Undo returns the undo data for the changes staged in the view
+func (v *utxoView) Undo() *BlockUndo {
+	return &BlockUndo{Spent: v.consume}
+}
+
+// WriteTo adds the staged changes to the batch
+func (v *utxoView) WriteTo(batch *StoreBatch) {
+	for _, utxo := range v.consume {
+		batch.DeleteUTXO(utxo.Key())
+		batch.DeleteStateLeaf(utxoStateKey(utxo))
+	}
+
+	for _, key := range v.order {
+		if utxo, ok := v.added[key]; ok {
+			batch.PutUTXO(utxo)
+			batch.PutStateLeaf(utxo)
+		}
+	}
+}
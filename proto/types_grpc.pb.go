@@ -24,6 +24,15 @@ const _ = grpc.SupportPackageIsVersion7
 type NodeClient interface {
 	Handshake(ctx context.Context, in *Version, opts ...grpc.CallOption) (*Version, error)
 	HandleTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Ack, error)
+	HandleBlock(ctx context.Context, in *Block, opts ...grpc.CallOption) (*Ack, error)
+	GetHeaders(ctx context.Context, in *GetHeadersRequest, opts ...grpc.CallOption) (Node_GetHeadersClient, error)
+	GetBlocks(ctx context.Context, in *GetBlocksRequest, opts ...grpc.CallOption) (Node_GetBlocksClient, error)
+	HandleProposal(ctx context.Context, in *Proposal, opts ...grpc.CallOption) (*Ack, error)
+	HandleVote(ctx context.Context, in *Vote, opts ...grpc.CallOption) (*Ack, error)
+	HandleCommit(ctx context.Context, in *CommitCertificate, opts ...grpc.CallOption) (*Ack, error)
+	HandleEvidence(ctx context.Context, in *Evidence, opts ...grpc.CallOption) (*Ack, error)
+	GetTxProof(ctx context.Context, in *GetTxProofRequest, opts ...grpc.CallOption) (*TxProof, error)
+	GetCommit(ctx context.Context, in *GetCommitRequest, opts ...grpc.CallOption) (*CommitCertificate, error)
 }
 
 type nodeClient struct {
@@ -52,12 +61,148 @@ func (c *nodeClient) HandleTransaction(ctx context.Context, in *Transaction, opt
 	return out, nil
 }
 
+func (c *nodeClient) HandleBlock(ctx context.Context, in *Block, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/HandleBlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetHeaders(ctx context.Context, in *GetHeadersRequest, opts ...grpc.CallOption) (Node_GetHeadersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Node_ServiceDesc.Streams[0], "/Node/GetHeaders", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nodeGetHeadersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Node_GetHeadersClient interface {
+	Recv() (*Header, error)
+	grpc.ClientStream
+}
+
+type nodeGetHeadersClient struct {
+	grpc.ClientStream
+}
+
+func (x *nodeGetHeadersClient) Recv() (*Header, error) {
+	m := new(Header)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *nodeClient) GetBlocks(ctx context.Context, in *GetBlocksRequest, opts ...grpc.CallOption) (Node_GetBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Node_ServiceDesc.Streams[1], "/Node/GetBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nodeGetBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Node_GetBlocksClient interface {
+	Recv() (*Block, error)
+	grpc.ClientStream
+}
+
+type nodeGetBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *nodeGetBlocksClient) Recv() (*Block, error) {
+	m := new(Block)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *nodeClient) HandleProposal(ctx context.Context, in *Proposal, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/HandleProposal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleVote(ctx context.Context, in *Vote, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/HandleVote", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleCommit(ctx context.Context, in *CommitCertificate, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/HandleCommit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleEvidence(ctx context.Context, in *Evidence, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/HandleEvidence", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetTxProof(ctx context.Context, in *GetTxProofRequest, opts ...grpc.CallOption) (*TxProof, error) {
+	out := new(TxProof)
+	err := c.cc.Invoke(ctx, "/Node/GetTxProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetCommit(ctx context.Context, in *GetCommitRequest, opts ...grpc.CallOption) (*CommitCertificate, error) {
+	out := new(CommitCertificate)
+	err := c.cc.Invoke(ctx, "/Node/GetCommit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NodeServer is the server API for Node service.
 // All implementations must embed UnimplementedNodeServer
 // for forward compatibility
 type NodeServer interface {
 	Handshake(context.Context, *Version) (*Version, error)
 	HandleTransaction(context.Context, *Transaction) (*Ack, error)
+	HandleBlock(context.Context, *Block) (*Ack, error)
+	GetHeaders(*GetHeadersRequest, Node_GetHeadersServer) error
+	GetBlocks(*GetBlocksRequest, Node_GetBlocksServer) error
+	HandleProposal(context.Context, *Proposal) (*Ack, error)
+	HandleVote(context.Context, *Vote) (*Ack, error)
+	HandleCommit(context.Context, *CommitCertificate) (*Ack, error)
+	HandleEvidence(context.Context, *Evidence) (*Ack, error)
+	GetTxProof(context.Context, *GetTxProofRequest) (*TxProof, error)
+	GetCommit(context.Context, *GetCommitRequest) (*CommitCertificate, error)
 	mustEmbedUnimplementedNodeServer()
 }
 
@@ -71,6 +216,33 @@ func (UnimplementedNodeServer) Handshake(context.Context, *Version) (*Version, e
 func (UnimplementedNodeServer) HandleTransaction(context.Context, *Transaction) (*Ack, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method HandleTransaction not implemented")
 }
+func (UnimplementedNodeServer) HandleBlock(context.Context, *Block) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleBlock not implemented")
+}
+func (UnimplementedNodeServer) GetHeaders(*GetHeadersRequest, Node_GetHeadersServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetHeaders not implemented")
+}
+func (UnimplementedNodeServer) GetBlocks(*GetBlocksRequest, Node_GetBlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetBlocks not implemented")
+}
+func (UnimplementedNodeServer) HandleProposal(context.Context, *Proposal) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleProposal not implemented")
+}
+func (UnimplementedNodeServer) HandleVote(context.Context, *Vote) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleVote not implemented")
+}
+func (UnimplementedNodeServer) HandleCommit(context.Context, *CommitCertificate) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleCommit not implemented")
+}
+func (UnimplementedNodeServer) HandleEvidence(context.Context, *Evidence) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleEvidence not implemented")
+}
+func (UnimplementedNodeServer) GetTxProof(context.Context, *GetTxProofRequest) (*TxProof, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTxProof not implemented")
+}
+func (UnimplementedNodeServer) GetCommit(context.Context, *GetCommitRequest) (*CommitCertificate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCommit not implemented")
+}
 func (UnimplementedNodeServer) mustEmbedUnimplementedNodeServer() {}
 
 // UnsafeNodeServer may be embedded to opt out of forward compatibility for this service.
@@ -120,6 +292,174 @@ func _Node_HandleTransaction_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Node_HandleBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Block)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/HandleBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleBlock(ctx, req.(*Block))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetHeaders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetHeadersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NodeServer).GetHeaders(m, &nodeGetHeadersServer{stream})
+}
+
+type Node_GetHeadersServer interface {
+	Send(*Header) error
+	grpc.ServerStream
+}
+
+type nodeGetHeadersServer struct {
+	grpc.ServerStream
+}
+
+func (x *nodeGetHeadersServer) Send(m *Header) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Node_GetBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetBlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NodeServer).GetBlocks(m, &nodeGetBlocksServer{stream})
+}
+
+type Node_GetBlocksServer interface {
+	Send(*Block) error
+	grpc.ServerStream
+}
+
+type nodeGetBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *nodeGetBlocksServer) Send(m *Block) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Node_HandleProposal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Proposal)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleProposal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/HandleProposal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleProposal(ctx, req.(*Proposal))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleVote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Vote)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleVote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/HandleVote",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleVote(ctx, req.(*Vote))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleCommit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitCertificate)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleCommit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/HandleCommit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleCommit(ctx, req.(*CommitCertificate))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleEvidence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Evidence)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleEvidence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/HandleEvidence",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleEvidence(ctx, req.(*Evidence))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetTxProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTxProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetTxProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetTxProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetTxProof(ctx, req.(*GetTxProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetCommit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetCommit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetCommit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetCommit(ctx, req.(*GetCommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Node_ServiceDesc is the grpc.ServiceDesc for Node service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -135,7 +475,46 @@ var Node_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "HandleTransaction",
 			Handler:    _Node_HandleTransaction_Handler,
 		},
+		{
+			MethodName: "HandleBlock",
+			Handler:    _Node_HandleBlock_Handler,
+		},
+		{
+			MethodName: "HandleProposal",
+			Handler:    _Node_HandleProposal_Handler,
+		},
+		{
+			MethodName: "HandleVote",
+			Handler:    _Node_HandleVote_Handler,
+		},
+		{
+			MethodName: "HandleCommit",
+			Handler:    _Node_HandleCommit_Handler,
+		},
+		{
+			MethodName: "HandleEvidence",
+			Handler:    _Node_HandleEvidence_Handler,
+		},
+		{
+			MethodName: "GetTxProof",
+			Handler:    _Node_GetTxProof_Handler,
+		},
+		{
+			MethodName: "GetCommit",
+			Handler:    _Node_GetCommit_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetHeaders",
+			Handler:       _Node_GetHeaders_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetBlocks",
+			Handler:       _Node_GetBlocks_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/types.proto",
 }
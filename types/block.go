@@ -3,13 +3,28 @@ package types
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"github.com/fzft/crypto-prd-blockchain/crypto"
 	"github.com/fzft/crypto-prd-blockchain/proto"
 	"github.com/fzft/crypto-prd-blockchain/util"
-	pb "github.com/golang/protobuf/proto"
 )
 
-const godSeed = "b3853c01222f908d08a87d0dd8ce7b0d1324d9967b5da9342ee185d5c1ee295e"
+// BlockVersion is the newest block version, the version of the blocks this
+// node produces. Version 2 blocks hash their merkle tree like RFC 6962,
+// version 1 blocks use the legacy tree. Version 3 headers add the state root.
+const BlockVersion = 3
+
+// StateRootVersion is the first block version whose header commits to the
+// utxo set after the block
+const StateRootVersion = 3
+
+// merkleScheme returns the merkle tree scheme of blocks with the given version
+func merkleScheme(version int32) util.MerkleScheme {
+	if version < 2 {
+		return util.MerkleLegacy
+	}
+	return util.MerkleRFC6962
+}
 
 type TxHash struct {
 	hash []byte
@@ -33,6 +48,10 @@ func VerifyBlock(block *proto.Block) bool {
 		}
 	}
 
+	if !bytes.Equal(block.Header.EvidenceHash, HashEvidence(block.Evidence)) {
+		return false
+	}
+
 	if len(block.Signature) != crypto.SignatureLen {
 		return false
 	}
@@ -46,40 +65,64 @@ func VerifyBlock(block *proto.Block) bool {
 	return sig.Verify(HashBlock(block), pubKey)
 }
 
-// GenerateCoinbaseTx generates a coinbase transaction.
-func GenerateCoinbaseTx() *proto.Transaction {
-	// hard code the god seed
-	prvKey := crypto.GeneratePrivateKeyFromSeedStr(godSeed)
+// CoinbaseOutIndex is the PrevOutIndex of the single input of a coinbase transaction.
+const CoinbaseOutIndex = 0xffffffff
+
+// GenerateCoinbaseTx generates a coinbase transaction paying amount to the
+// given address. Coinbase inputs are not signed, the signature field carries
+// the block height instead, so the coinbases of different blocks never share
+// a hash.
+func GenerateCoinbaseTx(height int32, address []byte, amount int64) *proto.Transaction {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(height))
 	return &proto.Transaction{
 		Version: 1,
 		Inputs: []*proto.TxInput{
 			{
 				PrevTxHash:   []byte{},
-				PrevOutIndex: 0xffffffff,
-				Signature:    []byte{},
+				PrevOutIndex: CoinbaseOutIndex,
+				Signature:    data,
 				PublicKey:    []byte{},
 			},
 		},
 		Outputs: []*proto.TxOutput{
 			{
-				Amount:  100,
-				Address: prvKey.PublicKey().Address().Bytes(),
+				Amount:  amount,
+				Address: address,
 			},
 		},
 	}
 }
 
+// IsCoinbaseTx returns true if the transaction is a coinbase transaction.
+func IsCoinbaseTx(tx *proto.Transaction) bool {
+	return len(tx.Inputs) == 1 &&
+		len(tx.Inputs[0].PrevTxHash) == 0 &&
+		tx.Inputs[0].PrevOutIndex == CoinbaseOutIndex
+}
+
+// CoinbaseHeight returns the block height a coinbase transaction was generated for.
+func CoinbaseHeight(tx *proto.Transaction) int32 {
+	data := tx.Inputs[0].Signature
+	if len(data) != 4 {
+		return -1
+	}
+	return int32(binary.BigEndian.Uint32(data))
+}
+
 // SignBlock signs the block.
 func SignBlock(pk *crypto.PrivateKey, block *proto.Block) *crypto.Signature {
-	hash := HashBlock(block)
-	sig := pk.Sign(hash)
-	block.PublicKey = pk.PublicKey().Bytes()
-	block.Signature = sig.Bytes()
-
+	// the root hash is part of the header, so it has to be set before signing
 	if len(block.Transactions) > 0 {
 		tree := GetMerkleTree(block)
 		block.Header.RootHash = tree.MerkleRoot()
 	}
+	block.Header.EvidenceHash = HashEvidence(block.Evidence)
+
+	hash := HashBlock(block)
+	sig := pk.Sign(hash)
+	block.PublicKey = pk.PublicKey().Bytes()
+	block.Signature = sig.Bytes()
 
 	return sig
 }
@@ -89,16 +132,24 @@ func HashBlock(block *proto.Block) []byte {
 	return HashHeader(block.Header)
 }
 
-func HashHeader(header *proto.Header) []byte {
-	b, err := pb.Marshal(header)
-	if err != nil {
-		panic(err)
+// HashValidators returns the hash of a validator set, the hash of the public
+// keys in the order of the set.
+func HashValidators(validators [][]byte) []byte {
+	h := sha256.New()
+	for _, validator := range validators {
+		h.Write(validator)
 	}
-	hash := sha256.Sum256(b)
+	return h.Sum(nil)
+}
+
+// HashHeader returns the hash of the canonical encoding of the header
+func HashHeader(header *proto.Header) []byte {
+	hash := sha256.Sum256(EncodeHeader(header))
 	return hash[:]
 }
 
-// GetMerkleTree calculates the root hash of the merkle tree.
+// GetMerkleTree builds the merkle tree of the transactions of the block with
+// the scheme of the block version.
 func GetMerkleTree(b *proto.Block) *util.MerkleTree[TxHash] {
 	if len(b.Transactions) == 0 {
 		return nil
@@ -109,7 +160,7 @@ func GetMerkleTree(b *proto.Block) *util.MerkleTree[TxHash] {
 		list[i] = NewTxHash(HashTransaction(tx))
 	}
 
-	t := util.NewMerkleTree(list)
+	t := util.NewMerkleTreeWithScheme(list, merkleScheme(b.Header.Version))
 	return t
 }
 
@@ -5,6 +5,7 @@ import (
 	"github.com/fzft/crypto-prd-blockchain/proto"
 	"github.com/fzft/crypto-prd-blockchain/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -41,3 +42,36 @@ func TestCalculateRootHash(t *testing.T) {
 	SignBlock(prvKey, block)
 	assert.True(t, VerifyRootHash(block))
 }
+
+func TestMerkleRootVersion(t *testing.T) {
+	block := util.RandomBlock()
+	block.Transactions = []*proto.Transaction{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	block.Header.Version = 1
+	legacy := GetMerkleTree(block).MerkleRoot()
+	block.Header.Version = BlockVersion
+	root := GetMerkleTree(block).MerkleRoot()
+	assert.NotEqual(t, legacy, root)
+
+	// legacy blocks keep verifying with the legacy tree
+	for version, want := range map[int32][]byte{1: legacy, BlockVersion: root} {
+		block.Header.Version = version
+		SignBlock(crypto.GeneratePrivateKey(), block)
+		assert.Equal(t, want, block.Header.RootHash)
+		assert.True(t, VerifyBlock(block))
+
+		proof, err := NewTxProof(block, HashTransaction(block.Transactions[2]))
+		require.Nil(t, err)
+		assert.True(t, VerifyTxProof(block.Header, proof))
+	}
+}
+
+func TestGenerateCoinbaseTx(t *testing.T) {
+	addr := crypto.GeneratePrivateKey().PublicKey().Address().Bytes()
+	tx := GenerateCoinbaseTx(7, addr, 100)
+
+	assert.True(t, IsCoinbaseTx(tx))
+	assert.Equal(t, int32(7), CoinbaseHeight(tx))
+	assert.NotEqual(t, HashTransaction(tx), HashTransaction(GenerateCoinbaseTx(8, addr, 100)))
+	assert.False(t, IsCoinbaseTx(&proto.Transaction{Version: 1}))
+}
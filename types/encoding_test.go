@@ -0,0 +1,58 @@
+package types
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"os"
+	"testing"
+)
+
+// encodingVector is a test vector of the canonical encoding, it holds either
+// a header or a transaction in the protobuf JSON mapping
+type encodingVector struct {
+	Name        string          `json:"name"`
+	Header      json.RawMessage `json:"header"`
+	Transaction json.RawMessage `json:"transaction"`
+	Encoding    string          `json:"encoding"`
+	Hash        string          `json:"hash"`
+}
+
+func TestEncodingVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/encoding.json")
+	require.Nil(t, err)
+	var vectors []encodingVector
+	require.Nil(t, json.Unmarshal(data, &vectors))
+	require.NotEmpty(t, vectors)
+
+	for _, v := range vectors {
+		var encoding, hash []byte
+		if v.Header != nil {
+			header := &proto.Header{}
+			require.Nil(t, protojson.Unmarshal(v.Header, header), v.Name)
+			encoding, hash = EncodeHeader(header), HashHeader(header)
+		} else {
+			tx := &proto.Transaction{}
+			require.Nil(t, protojson.Unmarshal(v.Transaction, tx), v.Name)
+			encoding, hash = EncodeTransaction(tx), HashTransaction(tx)
+		}
+		assert.Equal(t, v.Encoding, hex.EncodeToString(encoding), v.Name)
+		assert.Equal(t, v.Hash, hex.EncodeToString(hash), v.Name)
+		assert.Equal(t, EncodingVersion, encoding[0], v.Name)
+	}
+}
+
+func TestEncodingIsUnambiguous(t *testing.T) {
+	// byte strings are length prefixed, so bytes can not move between fields
+	a := &proto.Header{PrevHash: []byte{1, 2}}
+	b := &proto.Header{PrevHash: []byte{1}, RootHash: []byte{2}}
+	assert.NotEqual(t, EncodeHeader(a), EncodeHeader(b))
+
+	// a missing message encodes like an empty one
+	assert.Equal(t, EncodeHeader(&proto.Header{}), EncodeHeader(nil))
+	assert.Equal(t, EncodeTransaction(&proto.Transaction{}), EncodeTransaction(nil))
+	assert.NotPanics(t, func() { HashEvidence([]*proto.Evidence{{}}) })
+}
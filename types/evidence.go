@@ -0,0 +1,63 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+)
+
+// NewEvidence returns the evidence of the producer of both blocks signing two
+// different blocks at the same height. The blocks are not checked.
+func NewEvidence(a, b *proto.Block) *proto.Evidence {
+	if bytes.Compare(HashBlock(a), HashBlock(b)) > 0 {
+		a, b = b, a
+	}
+	return &proto.Evidence{
+		PublicKey:  a.PublicKey,
+		HeaderA:    a.Header,
+		SignatureA: a.Signature,
+		HeaderB:    b.Header,
+		SignatureB: b.Signature,
+	}
+}
+
+// VerifyEvidence returns true if the evidence holds two different headers of
+// the same height, both signed by its public key.
+func VerifyEvidence(evidence *proto.Evidence) bool {
+	if evidence.HeaderA == nil || evidence.HeaderB == nil || len(evidence.PublicKey) != crypto.PubKeyLen {
+		return false
+	}
+	if evidence.HeaderA.Height != evidence.HeaderB.Height {
+		return false
+	}
+
+	var (
+		hashA  = HashHeader(evidence.HeaderA)
+		hashB  = HashHeader(evidence.HeaderB)
+		pubKey = crypto.PublicKeyFromBytes(evidence.PublicKey)
+	)
+	if bytes.Compare(hashA, hashB) >= 0 {
+		return false
+	}
+	return verifySignature(pubKey, evidence.SignatureA, hashA) && verifySignature(pubKey, evidence.SignatureB, hashB)
+}
+
+func verifySignature(pubKey *crypto.PublicKey, sig, msg []byte) bool {
+	return len(sig) == crypto.SignatureLen && crypto.SignatureFromBytes(sig).Verify(msg, pubKey)
+}
+
+// HashEvidence returns the hash of the evidence of a block, nil if there is
+// none.
+func HashEvidence(evidence []*proto.Evidence) []byte {
+	if len(evidence) == 0 {
+		return nil
+	}
+
+	h := sha256.New()
+	for _, e := range evidence {
+		hash := sha256.Sum256(EncodeEvidence(e))
+		h.Write(hash[:])
+	}
+	return h.Sum(nil)
+}
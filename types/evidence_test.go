@@ -0,0 +1,51 @@
+package types
+
+import (
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVerifyEvidence(t *testing.T) {
+	var (
+		prvKey = crypto.GeneratePrivateKey()
+		a      = util.RandomBlock()
+		b      = util.RandomBlock()
+	)
+	b.Header.Height = a.Header.Height
+	SignBlock(prvKey, a)
+	SignBlock(prvKey, b)
+
+	evidence := NewEvidence(a, b)
+	assert.True(t, VerifyEvidence(evidence))
+	assert.Equal(t, evidence, NewEvidence(b, a))
+
+	// the same block twice is no evidence
+	assert.False(t, VerifyEvidence(NewEvidence(a, a)))
+
+	// both blocks have to be signed by the same key
+	SignBlock(crypto.GeneratePrivateKey(), b)
+	assert.False(t, VerifyEvidence(NewEvidence(a, b)))
+
+	// at the same height
+	b.Header.Height++
+	SignBlock(prvKey, b)
+	assert.False(t, VerifyEvidence(NewEvidence(a, b)))
+}
+
+func TestEvidenceHash(t *testing.T) {
+	prvKey := crypto.GeneratePrivateKey()
+	block := util.RandomBlock()
+	assert.Nil(t, HashEvidence(block.Evidence))
+
+	block.Evidence = []*proto.Evidence{{PublicKey: prvKey.PublicKey().Bytes()}}
+	SignBlock(prvKey, block)
+	assert.Len(t, block.Header.EvidenceHash, 32)
+	assert.True(t, VerifyBlock(block))
+
+	// the evidence is committed to by the header
+	block.Evidence = nil
+	assert.False(t, VerifyBlock(block))
+}
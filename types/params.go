@@ -0,0 +1,132 @@
+package types
+
+import "time"
+
+// ConsensusParams are the rules every node of a network has to agree on. They
+// are set once in the genesis file.
+type ConsensusParams struct {
+	// Engine is the consensus engine of the network, "poa", "pow" or "bft"
+	Engine string `json:"engine"`
+
+	// PowBits is the number of leading zero bits a block hash needs under
+	// proof-of-work until the first retarget, the initial difficulty is
+	// 2^PowBits
+	PowBits int `json:"powBits"`
+
+	// RetargetInterval is the number of blocks after which the proof-of-work
+	// difficulty is adjusted toward the block interval
+	RetargetInterval int `json:"retargetInterval"`
+
+	// BlockTime is the number of seconds between two blocks
+	BlockTime int64 `json:"blockTime"`
+
+	// BlockReward is the subsidy the coinbase of a block may pay to its
+	// producer before the first halving, on top of the fees of the block
+	BlockReward int64 `json:"blockReward"`
+
+	// HalvingInterval is the number of blocks after which the subsidy halves.
+	// If it is zero, the subsidy never changes.
+	HalvingInterval int `json:"halvingInterval"`
+
+	// CoinbaseMaturity is the number of blocks that have to follow a coinbase
+	// before its outputs can be spent
+	CoinbaseMaturity int `json:"coinbaseMaturity"`
+
+	// ProposerTimeout is the number of seconds a validator has to produce its
+	// block before the slot passes to the next validator. Under BFT it is the
+	// time the first round waits for a proposal or votes before moving on.
+	ProposerTimeout int64 `json:"proposerTimeout"`
+
+	// MaxBlockTxs is the maximum number of transactions in a block, including
+	// the coinbase
+	MaxBlockTxs int `json:"maxBlockTxs"`
+
+	// MaxBlockBytes is the maximum size of an encoded block
+	MaxBlockBytes int `json:"maxBlockBytes"`
+
+	// MedianTimeBlocks is the number of blocks whose median timestamp a new
+	// block has to be after
+	MedianTimeBlocks int `json:"medianTimeBlocks"`
+
+	// MaxFutureTime is the number of seconds a block timestamp may be ahead
+	// of the clock of a node
+	MaxFutureTime int64 `json:"maxFutureTime"`
+
+	// EpochLength is the number of blocks of an epoch. The validator set is
+	// elected from the bonded stake after every block at a multiple of it.
+	EpochLength int `json:"epochLength"`
+
+	// UnbondingPeriod is the number of blocks that have to follow an unbond
+	// transaction before its outputs can be spent
+	UnbondingPeriod int `json:"unbondingPeriod"`
+
+	// MinStake is the stake a validator needs to be elected
+	MinStake int64 `json:"minStake"`
+
+	// MaxValidators is the size of the elected validator set
+	MaxValidators int `json:"maxValidators"`
+
+	// SlashPercent is the share of its stake in percent a validator loses for
+	// signing two blocks at the same height
+	SlashPercent int64 `json:"slashPercent"`
+}
+
+// DefaultConsensusParams returns the parameters used for settings a genesis
+// file leaves out.
+func DefaultConsensusParams() ConsensusParams {
+	return ConsensusParams{
+		Engine:           "poa",
+		PowBits:          16,
+		RetargetInterval: 10,
+		BlockTime:        5,
+		ProposerTimeout:  10,
+		BlockReward:      100,
+		HalvingInterval:  210000,
+		CoinbaseMaturity: 100,
+		MaxBlockTxs:      1000,
+		MaxBlockBytes:    1 << 20,
+		MedianTimeBlocks: 11,
+		MaxFutureTime:    30,
+		EpochLength:      100,
+		UnbondingPeriod:  1000,
+		MinStake:         100,
+		MaxValidators:    21,
+		SlashPercent:     5,
+	}
+}
+
+// Subsidy returns the amount of new coins the block at the given height may
+// create. The subsidy halves every HalvingInterval blocks until it is zero.
+func (p ConsensusParams) Subsidy(height int) int64 {
+	if p.HalvingInterval <= 0 {
+		return p.BlockReward
+	}
+
+	halvings := height / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return p.BlockReward >> halvings
+}
+
+// Slash returns the part of the given stake a validator that signed two blocks
+// at the same height loses.
+func (p ConsensusParams) Slash(stake int64) int64 {
+	// split the stake so the product can not overflow
+	return stake/100*p.SlashPercent + stake%100*p.SlashPercent/100
+}
+
+// BlockInterval returns the time between two blocks
+func (p ConsensusParams) BlockInterval() time.Duration {
+	return time.Duration(p.BlockTime) * time.Second
+}
+
+// MaxFutureDrift returns how far a block timestamp may be ahead of the clock
+func (p ConsensusParams) MaxFutureDrift() time.Duration {
+	return time.Duration(p.MaxFutureTime) * time.Second
+}
+
+// Timeout returns the time a validator has to produce its block
+func (p ConsensusParams) Timeout() time.Duration {
+	return time.Duration(p.ProposerTimeout) * time.Second
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestSubsidy(t *testing.T) {
+	params := ConsensusParams{BlockReward: 100, HalvingInterval: 10}
+	assert.Equal(t, int64(100), params.Subsidy(0))
+	assert.Equal(t, int64(100), params.Subsidy(9))
+	assert.Equal(t, int64(50), params.Subsidy(10))
+	assert.Equal(t, int64(25), params.Subsidy(25))
+	assert.Equal(t, int64(0), params.Subsidy(70))
+	assert.Equal(t, int64(0), params.Subsidy(10*64))
+
+	params.HalvingInterval = 0
+	assert.Equal(t, int64(100), params.Subsidy(1000000))
+}
+
+func TestSlash(t *testing.T) {
+	params := ConsensusParams{SlashPercent: 5}
+	assert.Equal(t, int64(50), params.Slash(1000))
+	assert.Equal(t, int64(4), params.Slash(99))
+	assert.Equal(t, int64(math.MaxInt64/100*5+7*5/100), params.Slash(math.MaxInt64))
+
+	params.SlashPercent = 100
+	assert.Equal(t, int64(1000), params.Slash(1000))
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/util"
+)
+
+// NewTxProof returns the proof that the transaction with the given hash is
+// part of the block
+func NewTxProof(block *proto.Block, txHash []byte) (*proto.TxProof, error) {
+	for i, tx := range block.Transactions {
+		if !bytes.Equal(HashTransaction(tx), txHash) {
+			continue
+		}
+
+		proof, err := GetMerkleTree(block).Proof(i)
+		if err != nil {
+			return nil, err
+		}
+		return &proto.TxProof{
+			BlockHash:   HashBlock(block),
+			Height:      block.Header.Height,
+			Transaction: tx,
+			Hashes:      proof.Hashes,
+			Path:        proof.Path,
+		}, nil
+	}
+	return nil, fmt.Errorf("block has no transaction %x", txHash)
+}
+
+// VerifyTxProof returns true if the proof shows that its transaction is part
+// of the block with the given header. Only the header is needed, not the
+// block.
+func VerifyTxProof(header *proto.Header, proof *proto.TxProof) bool {
+	if header == nil || proof.Transaction == nil {
+		return false
+	}
+	if header.Height != proof.Height || !bytes.Equal(HashHeader(header), proof.BlockHash) {
+		return false
+	}
+
+	path := &util.MerkleProof{Scheme: merkleScheme(header.Version), Hashes: proof.Hashes, Path: proof.Path}
+	return util.VerifyProof(header.RootHash, HashTransaction(proof.Transaction), path)
+}
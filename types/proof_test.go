@@ -0,0 +1,38 @@
+package types
+
+import (
+	"github.com/fzft/crypto-prd-blockchain/crypto"
+	"github.com/fzft/crypto-prd-blockchain/proto"
+	"github.com/fzft/crypto-prd-blockchain/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTxProof(t *testing.T) {
+	block := util.RandomBlock()
+	for i := 0; i < 5; i++ {
+		block.Transactions = append(block.Transactions, &proto.Transaction{Version: int32(i)})
+	}
+	SignBlock(crypto.GeneratePrivateKey(), block)
+
+	for _, tx := range block.Transactions {
+		proof, err := NewTxProof(block, HashTransaction(tx))
+		require.Nil(t, err)
+		assert.Equal(t, tx, proof.Transaction)
+		assert.True(t, VerifyTxProof(block.Header, proof))
+	}
+
+	proof, err := NewTxProof(block, HashTransaction(block.Transactions[2]))
+	require.Nil(t, err)
+
+	// the proof is bound to its transaction and header
+	other := util.RandomBlock()
+	assert.False(t, VerifyTxProof(other.Header, proof))
+	assert.False(t, VerifyTxProof(nil, proof))
+	proof.Transaction = &proto.Transaction{Version: 7}
+	assert.False(t, VerifyTxProof(block.Header, proof))
+
+	_, err = NewTxProof(block, util.RandomHash())
+	assert.NotNil(t, err)
+}
@@ -2,39 +2,167 @@ package types
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"github.com/fzft/crypto-prd-blockchain/crypto"
 	"github.com/fzft/crypto-prd-blockchain/proto"
-	pb "github.com/golang/protobuf/proto"
 )
 
-// SignTransaction signs the transaction.
-func SignTransaction(pk *crypto.PrivateKey, tx *proto.Transaction) *crypto.Signature {
-	return pk.Sign(HashTransaction(tx))
+// Transaction signature errors
+var (
+	ErrInputIndex       = errors.New("input index out of range")
+	ErrInvalidSigHash   = errors.New("invalid signature hash type")
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// SigHash selects the parts of a transaction the signature of an input
+// commits to. The signatures themselves are never part of the message.
+type SigHash uint32
+
+const (
+	// SigHashAll commits to all inputs and all outputs
+	SigHashAll SigHash = 0
+	// SigHashSingle commits to all inputs and the output with the index of
+	// the signed input, the other outputs may change
+	SigHashSingle SigHash = 1
+	// SigHashAnyoneCanPay is combined with SigHashAll or SigHashSingle to
+	// commit to the signed input only, others may add inputs
+	SigHashAnyoneCanPay SigHash = 0x80
+)
+
+// base returns the sighash without the SigHashAnyoneCanPay flag
+func (s SigHash) base() SigHash {
+	return s &^ SigHashAnyoneCanPay
 }
 
-func HashTransaction(tx *proto.Transaction) []byte {
-	t, err := pb.Marshal(tx)
+// anyoneCanPay returns true if the SigHashAnyoneCanPay flag is set
+func (s SigHash) anyoneCanPay() bool {
+	return s&SigHashAnyoneCanPay != 0
+}
+
+// SignTransaction signs all inputs of the transaction with the key, committing
+// to the whole transaction.
+func SignTransaction(pk *crypto.PrivateKey, tx *proto.Transaction) error {
+	// every signature commits to the public keys of all inputs, so they have
+	// to be set before the first one is signed
+	for _, input := range tx.Inputs {
+		input.PublicKey = pk.PublicKey().Bytes()
+	}
+	for i := range tx.Inputs {
+		if err := SignInput(pk, tx, i, SigHashAll); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignInput signs the input with the given index with the key. The signature
+// commits to the parts of the transaction selected by sigHash, which is
+// stored in the input next to the signature.
+func SignInput(pk *crypto.PrivateKey, tx *proto.Transaction, index int, sigHash SigHash) error {
+	if index < 0 || index >= len(tx.Inputs) {
+		return fmt.Errorf("%w: transaction has no input %d", ErrInputIndex, index)
+	}
+
+	input := tx.Inputs[index]
+	input.PublicKey = pk.PublicKey().Bytes()
+	input.SigHash = uint32(sigHash)
+
+	msg, err := SignatureHash(tx, index, sigHash)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	hash := sha256.Sum256(t)
-	return hash[:]
+	input.Signature = pk.Sign(msg).Bytes()
+	return nil
 }
 
-// VerifyTransaction verifies the transaction.
-func VerifyTransaction(tx *proto.Transaction) bool {
-	for _, input := range tx.Inputs {
-		if len(input.Signature) == 0 {
-			panic("the transaction has no signature")
+// SignatureHash returns the message the input with the given index signs.
+// It is built from a copy of the transaction without any signatures, keeping
+// only the inputs and outputs selected by sigHash. The position of the input
+// is part of the message unless other inputs may be added.
+func SignatureHash(tx *proto.Transaction, index int, sigHash SigHash) ([]byte, error) {
+	if index < 0 || index >= len(tx.Inputs) {
+		return nil, fmt.Errorf("%w: transaction has no input %d", ErrInputIndex, index)
+	}
+
+	msg := &proto.Transaction{
+		Version: tx.Version,
+		Type:    tx.Type,
+	}
+
+	inputs := tx.Inputs
+	if sigHash.anyoneCanPay() {
+		inputs = tx.Inputs[index : index+1]
+	}
+	for _, input := range inputs {
+		msg.Inputs = append(msg.Inputs, &proto.TxInput{
+			PrevTxHash:   input.PrevTxHash,
+			PrevOutIndex: input.PrevOutIndex,
+			PublicKey:    input.PublicKey,
+		})
+	}
+
+	switch sigHash.base() {
+	case SigHashAll:
+		msg.Outputs = tx.Outputs
+	case SigHashSingle:
+		if index >= len(tx.Outputs) {
+			return nil, fmt.Errorf("%w: input %d has no matching output", ErrInvalidSigHash, index)
 		}
+		msg.Outputs = tx.Outputs[index : index+1]
+	default:
+		return nil, fmt.Errorf("%w: %#x", ErrInvalidSigHash, uint32(sigHash))
+	}
 
-		sig := crypto.SignatureFromBytes(input.Signature)
+	h := sha256.New()
+	h.Write(EncodeTransaction(msg))
+	if !sigHash.anyoneCanPay() {
+		binary.Write(h, binary.BigEndian, uint32(index))
+	}
+	binary.Write(h, binary.BigEndian, uint32(sigHash))
+	return h.Sum(nil), nil
+}
+
+// HashTransaction returns the hash of the canonical encoding of the
+// transaction
+func HashTransaction(tx *proto.Transaction) []byte {
+	hash := sha256.Sum256(EncodeTransaction(tx))
+	return hash[:]
+}
 
-		// TODO: this is a hack, we should not modify the transaction
-		input.Signature = nil
-		if !sig.Verify(HashTransaction(tx), crypto.PublicKeyFromBytes(input.PublicKey)) {
-			return false
+// VerifyTransaction verifies the signatures of all inputs of the transaction.
+// The transaction is not modified.
+func VerifyTransaction(tx *proto.Transaction) error {
+	for i := range tx.Inputs {
+		if err := VerifyInput(tx, i); err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
 		}
 	}
-	return true
+	return nil
+}
+
+// VerifyInput verifies the signature of the input with the given index
+func VerifyInput(tx *proto.Transaction, index int) error {
+	if index < 0 || index >= len(tx.Inputs) {
+		return fmt.Errorf("%w: transaction has no input %d", ErrInputIndex, index)
+	}
+
+	input := tx.Inputs[index]
+	if len(input.Signature) == 0 {
+		return ErrMissingSignature
+	}
+	if len(input.PublicKey) != crypto.PubKeyLen || len(input.Signature) != crypto.SignatureLen {
+		return ErrInvalidSignature
+	}
+
+	msg, err := SignatureHash(tx, index, SigHash(input.SigHash))
+	if err != nil {
+		return err
+	}
+	if !crypto.SignatureFromBytes(input.Signature).Verify(msg, crypto.PublicKeyFromBytes(input.PublicKey)) {
+		return ErrInvalidSignature
+	}
+	return nil
 }
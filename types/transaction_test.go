@@ -4,7 +4,9 @@ import (
 	"github.com/fzft/crypto-prd-blockchain/crypto"
 	"github.com/fzft/crypto-prd-blockchain/proto"
 	"github.com/fzft/crypto-prd-blockchain/util"
+	pb "github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -37,8 +39,109 @@ func TestHashTransaction(t *testing.T) {
 		Outputs: []*proto.TxOutput{output1, output2},
 	}
 
-	sig := SignTransaction(fromPrvKey, tx)
-	input.Signature = sig.Bytes()
+	require.Nil(t, SignTransaction(fromPrvKey, tx))
+	assert.Nil(t, VerifyTransaction(tx))
+}
+
+// testTx returns an unsigned transaction with the given number of inputs and
+// outputs
+func testTx(inputs, outputs int) *proto.Transaction {
+	tx := &proto.Transaction{Version: 1}
+	for i := 0; i < inputs; i++ {
+		tx.Inputs = append(tx.Inputs, &proto.TxInput{PrevTxHash: util.RandomHash()})
+	}
+	for i := 0; i < outputs; i++ {
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  int64(i + 1),
+			Address: crypto.GeneratePrivateKey().PublicKey().Address().Bytes(),
+		})
+	}
+	return tx
+}
+
+func TestVerifyTransactionKeepsSignatures(t *testing.T) {
+	tx := testTx(2, 1)
+	require.Nil(t, SignTransaction(crypto.GeneratePrivateKey(), tx))
+
+	before := pb.Clone(tx)
+	hash := HashTransaction(tx)
+	require.Nil(t, VerifyTransaction(tx))
+	assert.True(t, pb.Equal(before, tx))
+	assert.Equal(t, hash, HashTransaction(tx))
+
+	// the signature of one input can not be moved to another
+	tx.Inputs[0].Signature, tx.Inputs[1].Signature = tx.Inputs[1].Signature, tx.Inputs[0].Signature
+	assert.ErrorIs(t, VerifyTransaction(tx), ErrInvalidSignature)
+}
+
+func TestVerifyTransactionErrors(t *testing.T) {
+	var (
+		prvKey = crypto.GeneratePrivateKey()
+		tx     = testTx(1, 1)
+	)
+	assert.ErrorIs(t, VerifyTransaction(tx), ErrMissingSignature)
+	assert.ErrorIs(t, VerifyInput(tx, 1), ErrInputIndex)
+	assert.ErrorIs(t, SignInput(prvKey, tx, 1, SigHashAll), ErrInputIndex)
+	assert.ErrorIs(t, SignInput(prvKey, tx, 0, SigHash(2)), ErrInvalidSigHash)
+
+	require.Nil(t, SignInput(prvKey, tx, 0, SigHashAll))
+	tx.Inputs[0].SigHash = uint32(SigHashSingle)
+	assert.ErrorIs(t, VerifyTransaction(tx), ErrInvalidSignature)
+	tx.Inputs[0].SigHash = 0x40
+	assert.ErrorIs(t, VerifyTransaction(tx), ErrInvalidSigHash)
+
+	tx.Inputs[0].SigHash = uint32(SigHashAll)
+	tx.Inputs[0].Signature = tx.Inputs[0].Signature[1:]
+	assert.ErrorIs(t, VerifyTransaction(tx), ErrInvalidSignature)
+
+	// single needs an output with the index of the input
+	tx = testTx(2, 1)
+	assert.ErrorIs(t, SignInput(prvKey, tx, 1, SigHashSingle), ErrInvalidSigHash)
+}
+
+func TestSigHash(t *testing.T) {
+	var (
+		alice = crypto.GeneratePrivateKey()
+		bob   = crypto.GeneratePrivateKey()
+	)
+
+	for name, tc := range map[string]struct {
+		sigHash SigHash
+		change  func(tx *proto.Transaction)
+		valid   bool
+	}{
+		"all, change an output":    {SigHashAll, func(tx *proto.Transaction) { tx.Outputs[1].Amount++ }, false},
+		"all, add an output":       {SigHashAll, func(tx *proto.Transaction) { tx.Outputs = append(tx.Outputs, tx.Outputs[0]) }, false},
+		"all, add an input":        {SigHashAll, func(tx *proto.Transaction) { tx.Inputs = append(tx.Inputs, testTx(1, 0).Inputs...) }, false},
+		"all, change the type":     {SigHashAll, func(tx *proto.Transaction) { tx.Type = proto.TxType_BOND }, false},
+		"single, change own":       {SigHashSingle, func(tx *proto.Transaction) { tx.Outputs[0].Amount++ }, false},
+		"single, change other":     {SigHashSingle, func(tx *proto.Transaction) { tx.Outputs[1].Amount++ }, true},
+		"single, add an output":    {SigHashSingle, func(tx *proto.Transaction) { tx.Outputs = append(tx.Outputs, tx.Outputs[1]) }, true},
+		"single, add an input":     {SigHashSingle, func(tx *proto.Transaction) { tx.Inputs = append(tx.Inputs, testTx(1, 0).Inputs...) }, false},
+		"anyone, add an input":     {SigHashAll | SigHashAnyoneCanPay, func(tx *proto.Transaction) { tx.Inputs = append(tx.Inputs, testTx(1, 0).Inputs...) }, true},
+		"anyone, change an output": {SigHashAll | SigHashAnyoneCanPay, func(tx *proto.Transaction) { tx.Outputs[1].Amount++ }, false},
+		"anyone single, add both": {SigHashSingle | SigHashAnyoneCanPay, func(tx *proto.Transaction) {
+			tx.Inputs = append(tx.Inputs, testTx(1, 0).Inputs...)
+			tx.Outputs = append(tx.Outputs, testTx(0, 1).Outputs...)
+		}, true},
+	} {
+		tx := testTx(1, 2)
+		require.Nil(t, SignInput(alice, tx, 0, tc.sigHash), name)
+		require.Nil(t, VerifyInput(tx, 0), name)
+
+		tc.change(tx)
+		if tc.valid {
+			assert.Nil(t, VerifyInput(tx, 0), name)
+		} else {
+			assert.ErrorIs(t, VerifyInput(tx, 0), ErrInvalidSignature, name)
+		}
+	}
 
-	assert.True(t, VerifyTransaction(tx))
+	// bob adds an input to the transaction alice signed with anyone can pay
+	// and signs the whole transaction
+	tx := testTx(1, 2)
+	require.Nil(t, SignInput(alice, tx, 0, SigHashAll|SigHashAnyoneCanPay))
+	tx.Inputs = append(tx.Inputs, testTx(1, 0).Inputs...)
+	require.Nil(t, SignInput(bob, tx, 1, SigHashAll))
+	assert.Nil(t, VerifyTransaction(tx))
 }
@@ -3,15 +3,39 @@ package util
 import (
 	"bytes"
 	"crypto/sha256"
+	"fmt"
 )
 
 type Hashable interface {
 	Hash() []byte
 }
 
+// MerkleScheme selects how the leaves and inner nodes of a merkle tree are
+// hashed
+type MerkleScheme int
+
+const (
+	// MerkleRFC6962 hashes leaves as sha256(0x00 || hash) and inner nodes as
+	// sha256(0x01 || left || right) like RFC 6962, so a leaf can never pass
+	// for an inner node.
+	MerkleRFC6962 MerkleScheme = iota
+	// MerkleLegacy uses the hashes of the data as leaves and hashes inner
+	// nodes as sha256(left || right). A list of inner node hashes has the
+	// same root as the data below them, it is only kept to verify old
+	// blocks.
+	MerkleLegacy
+)
+
+// Prefixes of the hashes of RFC 6962 leaves and inner nodes
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
 type MerkleTree[T Hashable] struct {
-	Root *MerkleNode
-	Data []T
+	Root   *MerkleNode
+	Data   []T
+	Scheme MerkleScheme
 }
 
 type MerkleNode struct {
@@ -19,11 +43,21 @@ type MerkleNode struct {
 	Hash        []byte
 }
 
+// NewMerkleTree builds an RFC 6962 merkle tree over the data
 func NewMerkleTree[T Hashable](data []T) *MerkleTree[T] {
+	return NewMerkleTreeWithScheme(data, MerkleRFC6962)
+}
+
+// NewMerkleTreeWithScheme builds a merkle tree over the data hashed with the
+// given scheme. The tree is built level by level, pairing the nodes from the
+// left. The last node of a level with an odd number of nodes has no sibling
+// and moves up unchanged, which gives the same tree as the split at the
+// largest power of two of RFC 6962.
+func NewMerkleTreeWithScheme[T Hashable](data []T, scheme MerkleScheme) *MerkleTree[T] {
 	var nodes []*MerkleNode
 
 	for _, datum := range data {
-		nodes = append(nodes, NewMerkleNode(datum.Hash(), nil, nil))
+		nodes = append(nodes, &MerkleNode{Hash: scheme.leafHash(datum.Hash())})
 	}
 
 	for len(nodes) > 1 {
@@ -31,7 +65,11 @@ func NewMerkleTree[T Hashable](data []T) *MerkleTree[T] {
 
 		for i := 0; i < len(nodes); i += 2 {
 			if i+1 < len(nodes) {
-				level = append(level, NewMerkleNode([]byte{}, nodes[i], nodes[i+1]))
+				level = append(level, &MerkleNode{
+					Left:  nodes[i],
+					Right: nodes[i+1],
+					Hash:  scheme.nodeHash(nodes[i].Hash, nodes[i+1].Hash),
+				})
 			} else {
 				level = append(level, nodes[i])
 			}
@@ -40,9 +78,11 @@ func NewMerkleTree[T Hashable](data []T) *MerkleTree[T] {
 		nodes = level
 	}
 
-	return &MerkleTree[T]{Root: nodes[0], Data: data}
+	return &MerkleTree[T]{Root: nodes[0], Data: data, Scheme: scheme}
 }
 
+// NewMerkleNode returns an inner node of a legacy tree with the given
+// children, or a leaf with the given hash if it has none
 func NewMerkleNode(hash []byte, left, right *MerkleNode) *MerkleNode {
 	node := MerkleNode{
 		Left:  left,
@@ -51,14 +91,34 @@ func NewMerkleNode(hash []byte, left, right *MerkleNode) *MerkleNode {
 	}
 
 	if left != nil && right != nil {
-		hasher := sha256.New()
-		hasher.Write(append(left.Hash, right.Hash...))
-		node.Hash = hasher.Sum(nil)
+		node.Hash = MerkleLegacy.nodeHash(left.Hash, right.Hash)
 	}
 
 	return &node
 }
 
+// leafHash returns the hash of the leaf of a datum with the given hash
+func (s MerkleScheme) leafHash(hash []byte) []byte {
+	if s == MerkleLegacy {
+		return hash
+	}
+	hasher := sha256.New()
+	hasher.Write([]byte{leafPrefix})
+	hasher.Write(hash)
+	return hasher.Sum(nil)
+}
+
+// nodeHash returns the hash of an inner node with the given children
+func (s MerkleScheme) nodeHash(left, right []byte) []byte {
+	hasher := sha256.New()
+	if s != MerkleLegacy {
+		hasher.Write([]byte{nodePrefix})
+	}
+	hasher.Write(left)
+	hasher.Write(right)
+	return hasher.Sum(nil)
+}
+
 func (tree *MerkleTree[T]) MerkleRoot() []byte {
 	return tree.Root.Hash
 }
@@ -73,12 +133,78 @@ func (tree *MerkleTree[T]) verifyNode(node *MerkleNode) bool {
 	}
 
 	if node.Left != nil && node.Right != nil {
-		hasher := sha256.New()
-		hasher.Write(append(node.Left.Hash, node.Right.Hash...))
-		expectedHash := hasher.Sum(nil)
+		expectedHash := tree.Scheme.nodeHash(node.Left.Hash, node.Right.Hash)
 
 		return bytes.Equal(node.Hash, expectedHash) && tree.verifyNode(node.Left) && tree.verifyNode(node.Right)
 	}
 
 	return false
 }
+
+// MerkleProof proves that a leaf is part of a merkle tree. Hashes are the
+// siblings on the path from the leaf up to the root, bit i of Path is set if
+// Hashes[i] is the left sibling. Levels where the node on the path has no
+// sibling are skipped.
+type MerkleProof struct {
+	Scheme MerkleScheme
+	Hashes [][]byte
+	Path   uint64
+}
+
+// Proof returns the proof that the leaf with the given index is part of the
+// tree
+func (tree *MerkleTree[T]) Proof(index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(tree.Data) {
+		return nil, fmt.Errorf("tree has no leaf %d", index)
+	}
+
+	level := make([][]byte, len(tree.Data))
+	for i, datum := range tree.Data {
+		level[i] = tree.Scheme.leafHash(datum.Hash())
+	}
+
+	proof := &MerkleProof{Scheme: tree.Scheme}
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			if sibling < index {
+				proof.Path |= 1 << len(proof.Hashes)
+			}
+			proof.Hashes = append(proof.Hashes, level[sibling])
+		}
+
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, tree.Scheme.nodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyProof returns true if the proof shows that the datum with the given
+// hash is part of the tree with the given root. The tree itself is not
+// needed.
+func VerifyProof(root, leaf []byte, proof *MerkleProof) bool {
+	if proof == nil || len(proof.Hashes) > 64 {
+		return false
+	}
+	// no path bits beyond the hashes
+	if len(proof.Hashes) < 64 && proof.Path>>len(proof.Hashes) != 0 {
+		return false
+	}
+
+	hash := proof.Scheme.leafHash(leaf)
+	for i, sibling := range proof.Hashes {
+		if proof.Path&(1<<i) != 0 {
+			hash = proof.Scheme.nodeHash(sibling, hash)
+		} else {
+			hash = proof.Scheme.nodeHash(hash, sibling)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
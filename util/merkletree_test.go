@@ -2,7 +2,9 @@ package util
 
 import (
 	"crypto/sha256"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -52,3 +54,81 @@ func TestEmptyMerkleTree(t *testing.T) {
 	mt := NewMerkleTree(data)
 	assert.True(t, mt.VerifyTree())
 }
+
+// hashData is data with a given hash
+type hashData []byte
+
+func (d hashData) Hash() []byte {
+	return d
+}
+
+func TestMerkleTreeDomainSeparation(t *testing.T) {
+	a, b, c := MyData{Value: "a"}.Hash(), MyData{Value: "b"}.Hash(), MyData{Value: "c"}.Hash()
+
+	// a legacy tree can not tell an inner node from a leaf
+	legacy := NewMerkleTreeWithScheme([]hashData{a, b, c}, MerkleLegacy)
+	inner := NewMerkleTreeWithScheme([]hashData{a, b}, MerkleLegacy)
+	forged := NewMerkleTreeWithScheme([]hashData{inner.MerkleRoot(), c}, MerkleLegacy)
+	assert.Equal(t, legacy.MerkleRoot(), forged.MerkleRoot())
+
+	tree := NewMerkleTree([]hashData{a, b, c})
+	inner = NewMerkleTree([]hashData{a, b})
+	forged = NewMerkleTree([]hashData{inner.MerkleRoot(), c})
+	assert.NotEqual(t, tree.MerkleRoot(), forged.MerkleRoot())
+	assert.NotEqual(t, legacy.MerkleRoot(), tree.MerkleRoot())
+	assert.True(t, tree.VerifyTree())
+
+	// RFC 6962: leaves are sha256(0x00 || hash), nodes sha256(0x01 || left || right)
+	leaf := func(h []byte) []byte {
+		sum := sha256.Sum256(append([]byte{0x00}, h...))
+		return sum[:]
+	}
+	node := func(l, r []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{0x01}, l...), r...))
+		return sum[:]
+	}
+	assert.Equal(t, node(node(leaf(a), leaf(b)), leaf(c)), tree.MerkleRoot())
+	assert.Equal(t, leaf(a), NewMerkleTree([]hashData{a}).MerkleRoot())
+}
+
+func TestMerkleProof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		data := make([]MyData, size)
+		for i := range data {
+			data[i] = MyData{Value: fmt.Sprintf("leaf %d", i)}
+		}
+		for _, scheme := range []MerkleScheme{MerkleRFC6962, MerkleLegacy} {
+			testMerkleProof(t, NewMerkleTreeWithScheme(data, scheme))
+		}
+	}
+	assert.False(t, VerifyProof(nil, nil, nil))
+}
+
+// testMerkleProof checks the proofs of every leaf of the tree
+func testMerkleProof(t *testing.T, mt *MerkleTree[MyData]) {
+	root := mt.MerkleRoot()
+	for i, datum := range mt.Data {
+		proof, err := mt.Proof(i)
+		require.Nil(t, err)
+		assert.True(t, VerifyProof(root, datum.Hash(), proof), "leaf %d of %d", i, len(mt.Data))
+
+		// the proof is only valid for its own leaf
+		other := MyData{Value: "other"}
+		assert.False(t, VerifyProof(root, other.Hash(), proof))
+		if len(proof.Hashes) > 0 {
+			proof.Path ^= 1
+			assert.False(t, VerifyProof(root, datum.Hash(), proof))
+			proof.Path ^= 1 | 1<<len(proof.Hashes)
+			assert.False(t, VerifyProof(root, datum.Hash(), proof))
+		}
+	}
+
+	// a proof only holds for the scheme of its tree
+	proof, err := mt.Proof(0)
+	require.Nil(t, err)
+	proof.Scheme = 1 - proof.Scheme
+	assert.False(t, VerifyProof(root, mt.Data[0].Hash(), proof))
+
+	_, err = mt.Proof(len(mt.Data))
+	assert.NotNil(t, err)
+}
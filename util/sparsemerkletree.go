@@ -0,0 +1,269 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// SparseKeyLen is the length of the keys of a sparse merkle tree
+const SparseKeyLen = sha256.Size
+
+// emptyHash is the hash of an empty subtree
+var emptyHash = make([]byte, sha256.Size)
+
+// SparseMerkleTree is a merkle tree with a leaf for every possible 256 bit
+// key, almost all of them empty. Empty subtrees hash to 32 zero bytes and a
+// subtree holding a single key is replaced by the leaf of that key, so the
+// tree only stores the keys that are set and the root does not depend on the
+// order they were set in. Leaves hash as sha256(0x00 || key || value hash)
+// and inner nodes as sha256(0x01 || left || right).
+//
+// Trees are immutable, Update and Delete return a new tree that shares the
+// unchanged nodes with the old one.
+type SparseMerkleTree struct {
+	root *sparseNode
+}
+
+// sparseNode is a leaf if it has a key, an inner node otherwise. Inner nodes
+// have at least two keys below them.
+type sparseNode struct {
+	left, right *sparseNode
+	key, value  []byte
+	hash        []byte
+}
+
+func NewSparseMerkleTree() *SparseMerkleTree {
+	return &SparseMerkleTree{}
+}
+
+func newSparseLeaf(key, value []byte) *sparseNode {
+	hasher := sha256.New()
+	hasher.Write([]byte{leafPrefix})
+	hasher.Write(key)
+	hasher.Write(value)
+	return &sparseNode{key: key, value: value, hash: hasher.Sum(nil)}
+}
+
+func newSparseInner(left, right *sparseNode) *sparseNode {
+	return &sparseNode{left: left, right: right, hash: sparseInnerHash(left.Hash(), right.Hash())}
+}
+
+func sparseInnerHash(left, right []byte) []byte {
+	return MerkleRFC6962.nodeHash(left, right)
+}
+
+// Hash returns the hash of the subtree, the empty hash for a nil node
+func (n *sparseNode) Hash() []byte {
+	if n == nil {
+		return emptyHash
+	}
+	return n.hash
+}
+
+func (n *sparseNode) isLeaf() bool {
+	return n.key != nil
+}
+
+// bit returns the bit of the key at the given depth, the most significant
+// bit of the first byte comes first
+func bit(key []byte, depth int) byte {
+	return key[depth/8] >> (7 - depth%8) & 1
+}
+
+func checkKey(key []byte) {
+	if len(key) != SparseKeyLen {
+		panic(fmt.Sprintf("sparse merkle tree key has %d bytes", len(key)))
+	}
+}
+
+// Root returns the root hash of the tree
+func (t *SparseMerkleTree) Root() []byte {
+	return t.root.Hash()
+}
+
+// Get returns the value hash of the key
+func (t *SparseMerkleTree) Get(key []byte) ([]byte, bool) {
+	checkKey(key)
+	n := t.root
+	for depth := 0; n != nil; depth++ {
+		if n.isLeaf() {
+			if bytes.Equal(n.key, key) {
+				return n.value, true
+			}
+			return nil, false
+		}
+		n = n.child(bit(key, depth))
+	}
+	return nil, false
+}
+
+func (n *sparseNode) child(b byte) *sparseNode {
+	if b == 0 {
+		return n.left
+	}
+	return n.right
+}
+
+// Update returns the tree with the key set to the hash of the value
+func (t *SparseMerkleTree) Update(key []byte, value Hashable) *SparseMerkleTree {
+	checkKey(key)
+	leaf := newSparseLeaf(bytes.Clone(key), value.Hash())
+	return &SparseMerkleTree{root: insertSparse(t.root, leaf, 0)}
+}
+
+func insertSparse(n, leaf *sparseNode, depth int) *sparseNode {
+	if n == nil {
+		return leaf
+	}
+	if n.isLeaf() {
+		if bytes.Equal(n.key, leaf.key) {
+			return leaf
+		}
+		return splitSparse(n, leaf, depth)
+	}
+
+	if bit(leaf.key, depth) == 0 {
+		return newSparseInner(insertSparse(n.left, leaf, depth+1), n.right)
+	}
+	return newSparseInner(n.left, insertSparse(n.right, leaf, depth+1))
+}
+
+// splitSparse returns the subtree at the given depth holding two leaves with
+// different keys. Both move down until their keys differ.
+func splitSparse(a, b *sparseNode, depth int) *sparseNode {
+	bitA, bitB := bit(a.key, depth), bit(b.key, depth)
+	switch {
+	case bitA == bitB && bitA == 0:
+		return newSparseInner(splitSparse(a, b, depth+1), nil)
+	case bitA == bitB:
+		return newSparseInner(nil, splitSparse(a, b, depth+1))
+	case bitA == 0:
+		return newSparseInner(a, b)
+	default:
+		return newSparseInner(b, a)
+	}
+}
+
+// Delete returns the tree without the key
+func (t *SparseMerkleTree) Delete(key []byte) *SparseMerkleTree {
+	checkKey(key)
+	root := deleteSparse(t.root, key, 0)
+	if root == t.root {
+		return t
+	}
+	return &SparseMerkleTree{root: root}
+}
+
+func deleteSparse(n *sparseNode, key []byte, depth int) *sparseNode {
+	if n == nil {
+		return nil
+	}
+	if n.isLeaf() {
+		if bytes.Equal(n.key, key) {
+			return nil
+		}
+		return n
+	}
+
+	left, right := n.left, n.right
+	if bit(key, depth) == 0 {
+		left = deleteSparse(left, key, depth+1)
+	} else {
+		right = deleteSparse(right, key, depth+1)
+	}
+	if left == n.left && right == n.right {
+		return n
+	}
+
+	// a leaf left alone in its subtree takes the place of the subtree
+	if left == nil && (right == nil || right.isLeaf()) {
+		return right
+	}
+	if right == nil && left.isLeaf() {
+		return left
+	}
+	return newSparseInner(left, right)
+}
+
+// SparseMerkleProof proves that a key is set to a value in a sparse merkle
+// tree, or that it is not set. Siblings are the hashes of the siblings on the
+// path of the key from the root down to the first leaf or empty subtree.
+// LeafKey and LeafValue are the key and value hash of that leaf, they are
+// empty if the path ends in an empty subtree.
+type SparseMerkleProof struct {
+	Siblings  [][]byte
+	LeafKey   []byte
+	LeafValue []byte
+}
+
+// Prove returns the proof that the key is set or not set in the tree
+func (t *SparseMerkleTree) Prove(key []byte) *SparseMerkleProof {
+	checkKey(key)
+	proof := &SparseMerkleProof{}
+	n := t.root
+	for depth := 0; n != nil; depth++ {
+		if n.isLeaf() {
+			proof.LeafKey, proof.LeafValue = n.key, n.value
+			break
+		}
+		b := bit(key, depth)
+		proof.Siblings = append(proof.Siblings, n.child(1-b).Hash())
+		n = n.child(b)
+	}
+	return proof
+}
+
+// VerifyMembership returns true if the proof shows that the key is set to
+// the hash of the value in the tree with the given root
+func (p *SparseMerkleProof) VerifyMembership(root, key []byte, value Hashable) bool {
+	if len(key) != SparseKeyLen || !bytes.Equal(p.LeafKey, key) || !bytes.Equal(p.LeafValue, value.Hash()) {
+		return false
+	}
+	return p.verify(root, key)
+}
+
+// VerifyNonMembership returns true if the proof shows that the key is not
+// set in the tree with the given root
+func (p *SparseMerkleProof) VerifyNonMembership(root, key []byte) bool {
+	if len(key) != SparseKeyLen {
+		return false
+	}
+	if p.LeafKey != nil {
+		// the path has to end in the leaf of another key on the same path
+		if len(p.LeafKey) != SparseKeyLen || bytes.Equal(p.LeafKey, key) || len(p.Siblings) > 8*SparseKeyLen {
+			return false
+		}
+		for depth := range p.Siblings {
+			if bit(p.LeafKey, depth) != bit(key, depth) {
+				return false
+			}
+		}
+	}
+	return p.verify(root, key)
+}
+
+// verify returns true if the path of the key ends in the leaf of the proof
+// in the tree with the given root
+func (p *SparseMerkleProof) verify(root, key []byte) bool {
+	if len(p.Siblings) > 8*SparseKeyLen {
+		return false
+	}
+
+	hash := emptyHash
+	if p.LeafKey != nil {
+		hash = newSparseLeaf(p.LeafKey, p.LeafValue).hash
+	}
+	for depth := len(p.Siblings) - 1; depth >= 0; depth-- {
+		sibling := p.Siblings[depth]
+		if len(sibling) != sha256.Size {
+			return false
+		}
+		if bit(key, depth) == 0 {
+			hash = sparseInnerHash(hash, sibling)
+		} else {
+			hash = sparseInnerHash(sibling, hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
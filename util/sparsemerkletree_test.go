@@ -0,0 +1,107 @@
+package util
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+// sparseKey returns the key of the given name
+func sparseKey(name string) []byte {
+	key := sha256.Sum256([]byte(name))
+	return key[:]
+}
+
+func TestSparseMerkleTree(t *testing.T) {
+	tree := NewSparseMerkleTree()
+	assert.Equal(t, make([]byte, 32), tree.Root())
+
+	var (
+		keys  [][]byte
+		roots [][]byte
+	)
+	for i := 0; i < 50; i++ {
+		key := sparseKey(fmt.Sprintf("key %d", i))
+		tree = tree.Update(key, MyData{Value: fmt.Sprint(i)})
+		keys = append(keys, key)
+		roots = append(roots, tree.Root())
+	}
+
+	value, ok := tree.Get(keys[7])
+	require.True(t, ok)
+	assert.Equal(t, MyData{Value: "7"}.Hash(), value)
+	_, ok = tree.Get(sparseKey("missing"))
+	assert.False(t, ok)
+
+	// the root does not depend on the order the keys were set in
+	shuffled := NewSparseMerkleTree()
+	for _, i := range rand.Perm(len(keys)) {
+		shuffled = shuffled.Update(keys[i], MyData{Value: fmt.Sprint(i)})
+	}
+	assert.Equal(t, tree.Root(), shuffled.Root())
+
+	// deleting the keys again goes back through the same roots
+	old := tree
+	for i := len(keys) - 1; i > 0; i-- {
+		tree = tree.Delete(keys[i])
+		assert.Equal(t, roots[i-1], tree.Root(), i)
+	}
+	tree = tree.Delete(keys[0])
+	assert.Equal(t, make([]byte, 32), tree.Root())
+
+	// trees are immutable
+	assert.Equal(t, roots[len(roots)-1], old.Root())
+	assert.Equal(t, old, old.Delete(sparseKey("missing")))
+
+	// setting a key again replaces its value
+	updated := old.Update(keys[3], MyData{Value: "new"})
+	assert.NotEqual(t, old.Root(), updated.Root())
+	assert.Equal(t, old.Root(), updated.Update(keys[3], MyData{Value: "3"}).Root())
+
+	assert.Panics(t, func() { tree.Update([]byte{1}, MyData{}) })
+}
+
+func TestSparseMerkleProof(t *testing.T) {
+	tree := NewSparseMerkleTree()
+	missing := sparseKey("missing")
+
+	// an empty tree has no keys
+	proof := tree.Prove(missing)
+	assert.True(t, proof.VerifyNonMembership(tree.Root(), missing))
+
+	for i := 0; i < 20; i++ {
+		tree = tree.Update(sparseKey(fmt.Sprint(i)), MyData{Value: fmt.Sprint(i)})
+	}
+	root := tree.Root()
+
+	for i := 0; i < 20; i++ {
+		key, value := sparseKey(fmt.Sprint(i)), MyData{Value: fmt.Sprint(i)}
+		proof := tree.Prove(key)
+		assert.True(t, proof.VerifyMembership(root, key, value), i)
+		assert.False(t, proof.VerifyNonMembership(root, key), i)
+		assert.False(t, proof.VerifyMembership(root, key, MyData{Value: "other"}), i)
+		assert.False(t, proof.VerifyMembership(NewSparseMerkleTree().Root(), key, value), i)
+	}
+
+	for i := 0; i < 20; i++ {
+		key := sparseKey(fmt.Sprintf("missing %d", i))
+		proof := tree.Prove(key)
+		assert.True(t, proof.VerifyNonMembership(root, key), i)
+		assert.False(t, proof.VerifyMembership(root, key, MyData{}), i)
+	}
+
+	// a proof of another key does not prove a key is missing
+	key := sparseKey("0")
+	proof = tree.Prove(key)
+	proof.LeafKey = missing
+	assert.False(t, proof.VerifyNonMembership(root, missing))
+
+	proof = tree.Prove(missing)
+	if len(proof.Siblings) > 0 {
+		proof.Siblings[0] = proof.Siblings[0][1:]
+		assert.False(t, proof.VerifyNonMembership(root, missing))
+	}
+}